@@ -1,13 +1,24 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/shadowdara/finder/pub/argparser"
+	"github.com/shadowdara/finder/pub/color"
 
 	"github.com/shadowdara/finder/internal/config"
 	"github.com/shadowdara/finder/internal/finderversion"
+	"github.com/shadowdara/finder/internal/search"
 	"github.com/shadowdara/finder/internal/search/binarycheck"
+	"github.com/shadowdara/finder/internal/structure"
 )
 
 // HandleCommand is the main entry point for CLI command processing.
@@ -31,7 +42,7 @@ func HandleCommand(args []string) {
 
 	// Temaplte Command
 	templateCmd := argparser.NewCommand("template",
-		"to search for a template - for the case that the name for a template is overwritten by another argument name",
+		"to search for one or more templates - for the case that the name for a template is overwritten by another argument name",
 		false, "tpl")
 
 	// Check Command
@@ -54,10 +65,65 @@ func HandleCommand(args []string) {
 	binarySearchCmd := argparser.NewCommand(
 		"-b", "search for executables in path", false)
 
+	// Detect the templates of a directory
+	detectCmd := argparser.NewCommand("detect",
+		"show which templates a directory matches (default: current directory)", false)
+	detectCmd.String("output", "",
+		"output type: normal, json, ndjson or clear (only names)", false, "o")
+
+	// Explain why a directory matches a template or not
+	explainCmd := argparser.NewCommand("explain",
+		"show rule by rule why a directory matches a template or not: explain <template> <dir>", false)
+	explainCmd.String("output", "",
+		"output type: normal or json", false, "o")
+
+	// Find the enclosing directories matching a template
+	upCmd := argparser.NewCommand("up",
+		"print the nearest directory above the current one which matches a template: up <template>", false)
+	upCmd.Bool("all", false,
+		"print every enclosing directory which matches, nearest first", false)
+	upCmd.String("output", "",
+		"output type: normal, json, ndjson or clear (only paths)", false, "o")
+
+	// Run a command in every found directory
+	runCmd := argparser.NewCommand("run",
+		"run a command in every directory matching the templates: run <template>... -- <command>", false)
+
+	// Watch a directory for projects appearing and disappearing
+	watchCmd := argparser.NewCommand("watch",
+		"print directories which start (+) or stop (-) matching a template: watch <template> [root]", false)
+	addWatchFlags(watchCmd)
+
+	// Directory index for faster searches
+	indexCmd := argparser.NewCommand("index",
+		"manage the directory index used by searches with --index", false)
+	indexBuildCmd := argparser.NewCommand("build",
+		"index all directories below the roots, replacing the old index", false)
+	indexUpdateCmd := argparser.NewCommand("update",
+		"read the directories again which changed since the index was built", false)
+	indexStatusCmd := argparser.NewCommand("status",
+		"show the roots, size and age of the index", false)
+	indexBuildCmd.Strings("root",
+		"directory to index, can be used multiple times (default: current directory or $FINDER_ROOT)",
+		false, "C")
+	addIndexFlags(indexBuildCmd)
+	addIndexFlags(indexUpdateCmd)
+	indexCmd.AddSubcommand(indexBuildCmd)
+	indexCmd.AddSubcommand(indexUpdateCmd)
+	indexCmd.AddSubcommand(indexStatusCmd)
+
 	// help
 	helpCmd := argparser.NewCommand("help",
 		"shows help", true, "--help", "h", "-h")
 
+	// Options for the commands which search the filesystem
+	addSearchFlags(root)
+	addSearchFlags(templateCmd)
+	addSearchFlags(tagSearchCmd)
+	addSearchFlags(runCmd)
+	tagSearchCmd.Bool("search", false,
+		"search the filesystem with every template carrying the tag", false)
+
 	root.AddSubcommand(versionCmd)
 	root.AddSubcommand(templateCmd)
 	root.AddSubcommand(checkCmd)
@@ -65,11 +131,25 @@ func HandleCommand(args []string) {
 	root.AddSubcommand(tagsCmd)
 	root.AddSubcommand(tagSearchCmd)
 	root.AddSubcommand(binarySearchCmd)
+	root.AddSubcommand(detectCmd)
+	root.AddSubcommand(explainCmd)
+	root.AddSubcommand(upCmd)
+	root.AddSubcommand(runCmd)
+	root.AddSubcommand(indexCmd)
+	root.AddSubcommand(watchCmd)
 	root.AddSubcommand(helpCmd)
 
 	// Parse the Arguments
 	cmd := root.Parse(args[1:])
 
+	// Ctrl-C stops a running search, a second Ctrl-C kills the program
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Evaluate the Arguments
 	switch cmd {
 	case versionCmd:
@@ -97,12 +177,157 @@ func HandleCommand(args []string) {
 			return
 		}
 
+	case detectCmd:
+		if err := outputType(cmd, &finderconfig); err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		dir := "."
+		if len(cmd.Args) > 0 {
+			dir = cmd.Args[0]
+		}
+		if err := Detect(ctx, dir, finderconfig.OutputType); err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(1)
+		}
+
+	case explainCmd:
+		if len(cmd.Args) < 2 {
+			root.PrintHelp()
+			return
+		}
+		if err := outputType(cmd, &finderconfig); err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		matched, err := Explain(ctx, cmd.Args[0], cmd.Args[1], finderconfig.OutputType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(1)
+		}
+		if !matched {
+			os.Exit(1)
+		}
+
+	case upCmd:
+		if len(cmd.Args) <= 0 {
+			root.PrintHelp()
+			return
+		}
+		if err := outputType(cmd, &finderconfig); err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		found, err := Up(ctx, cmd.Args[0], cmd.GetBool("all"), finderconfig.OutputType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(exitCode(err))
+		}
+		if !found {
+			os.Exit(1)
+		}
+
+	case runCmd:
+		if len(cmd.Args) <= 0 || len(cmd.Rest) <= 0 {
+			root.PrintHelp()
+			return
+		}
+
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err == nil && opts.Executes() {
+			err = errors.New("--exec and --exec-batch can not be used with run")
+		}
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		err = Run(ctx, cmd.Args, cmd.Rest, finderconfig.OutputType, opts)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+
+	case watchCmd:
+		if len(cmd.Args) <= 0 {
+			root.PrintHelp()
+			return
+		}
+
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err == nil && finderconfig.OutputType == "json" {
+			err = errors.New("watch prints events while running, use -o ndjson instead of json")
+		}
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		dir := "."
+		if len(cmd.Args) > 1 {
+			dir = cmd.Args[1]
+		}
+		if err := Watch(ctx, cmd.Args[0], dir, finderconfig.OutputType, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(1)
+		}
+
+	case indexCmd:
+		indexCmd.PrintHelp()
+
+	case indexBuildCmd, indexUpdateCmd:
+		if cmd == indexUpdateCmd && len(cmd.Args) > 0 {
+			// Like -C <dir>, which update does not have
+			fmt.Printf("%sindex update always updates the roots of the index, use 'finder index build -C <dir>' for other roots%s\n",
+				color.Red, color.Reset)
+			return
+		}
+
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		if cmd == indexBuildCmd {
+			err = IndexBuild(ctx, opts)
+		} else {
+			err = IndexUpdate(ctx, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(exitCode(err))
+		}
+
+	case indexStatusCmd:
+		if err := IndexStatus(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s%v%s\n", color.Red, err, color.Reset)
+			os.Exit(1)
+		}
+
 	case tagSearchCmd:
 		if len(cmd.Args) <= 0 {
 			root.PrintHelp()
 			return
 		}
 
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
+
+		if cmd.GetBool("search") {
+			// Search the filesystem with all templates carrying the tag
+			err = TagSearchFind(ctx, cmd.Args[0], finderconfig.OutputType, finderconfig.OutputType == "normal" && !opts.Executes(), opts)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+
 		// Search for tags
 		TagSearch(cmd.Args[0], finderconfig.OutputType, true)
 	case templateCmd:
@@ -111,15 +336,267 @@ func HandleCommand(args []string) {
 			return
 		}
 
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
 		// Search the Template
-		Search(cmd.Args[0], finderconfig.OutputType, true)
+		err = Search(ctx, cmd.Args, finderconfig.OutputType, finderconfig.OutputType == "normal" && !opts.Executes(), opts)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
 	default:
 		if len(cmd.Args) <= 0 {
 			root.PrintHelp()
 			return
 		}
 
+		opts, err := searchOptions(cmd, &finderconfig)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", color.Red, err, color.Reset)
+			return
+		}
 		// Search the Template
-		Search(cmd.Args[0], finderconfig.OutputType, true)
+		err = Search(ctx, cmd.Args, finderconfig.OutputType, finderconfig.OutputType == "normal" && !opts.Executes(), opts)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+	}
+}
+
+// addSearchFlags registers the flags shared by all commands which search
+// the filesystem.
+func addSearchFlags(cmd *argparser.Command) {
+	cmd.String("output", "",
+		"output type: normal, json, ndjson or clear (only paths)", false, "o")
+	cmd.Strings("root",
+		"directory to search in, can be used multiple times (default: current directory or $FINDER_ROOT)",
+		false, "C")
+	cmd.Strings("exclude",
+		"skip directories matching this gitignore style pattern, can be used multiple times", false)
+	cmd.Bool("no-default-excludes", false,
+		"also search directories like node_modules, .cache and the trash bin", false)
+	cmd.String("jobs", "",
+		"number of directories read in parallel (default: number of CPUs)", false, "j")
+	cmd.String("timeout", "",
+		"stop the search after this time (e.g. 30s, 5m) and print the results found so far", false)
+	cmd.String("command-timeout", "",
+		"kill a template command after this time, 0 disables it (default: 30s)", false)
+	cmd.String("command-jobs", "",
+		"number of template commands running at the same time (default: number of CPUs)", false)
+	cmd.String("exec", "",
+		"run a command in every found directory instead of printing it, {} is replaced by the path, {/} by the name and {//} by the parent", false)
+	cmd.String("exec-batch", "",
+		"run a command once with all found directories in place of {} or appended", false)
+	cmd.String("exec-jobs", "",
+		"number of --exec commands running at the same time (default: number of CPUs)", false)
+	cmd.Bool("index", false,
+		"use the directory index instead of reading every directory (see finder index)", false)
+	cmd.Bool("prune-matches", false,
+		"do not search inside a found directory", false)
+	cmd.Bool("nested", false,
+		"also print the enclosing found directory of every result", false)
+	cmd.String("columns", "",
+		"comma separated result fields to print: "+strings.Join(search.Columns, ", "), false)
+	cmd.String("sort", "",
+		"print the results after the search sorted by: "+strings.Join(search.SortKeys, ", "), false)
+	cmd.Bool("reverse", false,
+		"reverse the order of the results", false)
+	cmd.Bool("group", false,
+		"print the results grouped by template (normal and json output only)", false)
+	cmd.String("max-depth", "",
+		"do not search deeper than this many directories below a root", false)
+	cmd.String("min-depth", "",
+		"only report matches at least this many directories below a root", false)
+	cmd.String("modified-within", "",
+		"only report matches modified within this age (e.g. 30d, 12h) or since this date (e.g. 2025-01-01)", false)
+	cmd.String("modified-before", "",
+		"only report matches last modified more than this age ago or before this date", false)
+}
+
+// addWatchFlags registers the flags of watch, which searches like the
+// other commands but has a single root.
+func addWatchFlags(cmd *argparser.Command) {
+	cmd.String("output", "",
+		"output type: normal, ndjson or clear (+path and -path without colors)", false, "o")
+	cmd.Strings("exclude",
+		"skip directories matching this gitignore style pattern, can be used multiple times", false)
+	cmd.Bool("no-default-excludes", false,
+		"also watch directories like node_modules, .cache and the trash bin", false)
+	cmd.String("jobs", "",
+		"number of directories read in parallel (default: number of CPUs)", false, "j")
+	cmd.String("command-timeout", "",
+		"kill a template command after this time, 0 disables it (default: 30s)", false)
+	cmd.Bool("prune-matches", false,
+		"do not watch for matches inside a found directory", false)
+	cmd.String("max-depth", "",
+		"do not watch deeper than this many directories below the root", false)
+	cmd.String("min-depth", "",
+		"only report matches at least this many directories below the root", false)
+	cmd.String("modified-within", "",
+		"only report matches modified within this age (e.g. 30d, 12h) or since this date (e.g. 2025-01-01)", false)
+	cmd.String("modified-before", "",
+		"only report matches last modified more than this age ago or before this date", false)
+}
+
+// addIndexFlags registers the flags of the commands which walk the
+// filesystem to build or update the index. Only build has --root, update
+// always walks the roots of the index.
+func addIndexFlags(cmd *argparser.Command) {
+	cmd.Strings("exclude",
+		"skip directories matching this gitignore style pattern, can be used multiple times", false)
+	cmd.Bool("no-default-excludes", false,
+		"also index directories like node_modules, .cache and the trash bin", false)
+	cmd.String("jobs", "",
+		"number of directories read in parallel (default: number of CPUs)", false, "j")
+}
+
+// searchOptions builds the search options from the parsed flags of cmd,
+// falling back to the values from the config. The output type from the
+// flags is stored in the config.
+func searchOptions(cmd *argparser.Command, finderconfig *config.Config) (search.Options, error) {
+	if err := outputType(cmd, finderconfig); err != nil {
+		return search.Options{}, err
+	}
+
+	opts := search.NewOptions()
+	opts.Roots = finderconfig.Roots
+
+	if roots := cmd.GetStrings("root"); len(roots) > 0 {
+		opts.Roots = roots
+	}
+
+	opts.Excludes = cmd.GetStrings("exclude")
+	opts.NoDefaultExcludes = cmd.GetBool("no-default-excludes")
+	opts.PruneMatches = cmd.GetBool("prune-matches")
+	opts.Nested = cmd.GetBool("nested")
+	opts.Group = cmd.GetBool("group")
+	if columns := cmd.GetString("columns"); columns != "" {
+		for _, c := range strings.Split(columns, ",") {
+			c = strings.TrimSpace(c)
+			if !search.IsColumn(c) {
+				return opts, fmt.Errorf("unknown column '%s', use some of: %s",
+					c, strings.Join(search.Columns, ", "))
+			}
+			opts.Columns = append(opts.Columns, c)
+		}
+	}
+	opts.Sort = cmd.GetString("sort")
+	if opts.Sort != "" && !search.IsSortKey(opts.Sort) {
+		return opts, fmt.Errorf("unknown sort key '%s', use one of: %s",
+			opts.Sort, strings.Join(search.SortKeys, ", "))
+	}
+	opts.Reverse = cmd.GetBool("reverse")
+	if cmd.GetBool("index") {
+		path, err := search.DefaultIndexPath()
+		if err != nil {
+			return opts, err
+		}
+		if opts.Index, err = search.LoadIndex(path); err != nil {
+			return opts, err
+		}
+	}
+	opts.Exec = cmd.GetString("exec")
+	opts.ExecBatch = cmd.GetString("exec-batch")
+	if opts.Exec != "" && opts.ExecBatch != "" {
+		return opts, fmt.Errorf("--exec and --exec-batch can not be used together")
+	}
+
+	var err error
+	if opts.MaxDepth, err = intFlag(cmd, "max-depth"); err != nil {
+		return opts, err
+	}
+	if cmd.GetString("max-depth") != "" && opts.MaxDepth == 0 {
+		// 0 means unlimited and could not override the max_depth of a template
+		return opts, fmt.Errorf("--max-depth needs a number >= 1, a root has depth 0")
+	}
+	if opts.MinDepth, err = intFlag(cmd, "min-depth"); err != nil {
+		return opts, err
+	}
+	if opts.MaxDepth > 0 && opts.MinDepth > opts.MaxDepth {
+		return opts, fmt.Errorf("--min-depth %d is larger than --max-depth %d, nothing could be found", opts.MinDepth, opts.MaxDepth)
+	}
+	if opts.Jobs, err = intFlag(cmd, "jobs"); err != nil {
+		return opts, err
+	}
+	if opts.CommandJobs, err = intFlag(cmd, "command-jobs"); err != nil {
+		return opts, err
+	}
+	if opts.ExecJobs, err = intFlag(cmd, "exec-jobs"); err != nil {
+		return opts, err
+	}
+	if timeout := cmd.GetString("command-timeout"); timeout != "" {
+		opts.CommandTimeout, err = time.ParseDuration(timeout)
+		if timeout == "0" {
+			opts.CommandTimeout, err = 0, nil
+		}
+		if err != nil || opts.CommandTimeout < 0 {
+			return opts, fmt.Errorf("--command-timeout needs a duration like 10s or 0, got '%s'", timeout)
+		}
+	}
+	for _, name := range []string{"modified-within", "modified-before"} {
+		if value := cmd.GetString(name); value != "" {
+			if _, err := structure.ParseTime(value, time.Now()); err != nil {
+				return opts, fmt.Errorf("--%s: %v", name, err)
+			}
+		}
+	}
+	opts.ModifiedWithin = cmd.GetString("modified-within")
+	opts.ModifiedBefore = cmd.GetString("modified-before")
+	if timeout := cmd.GetString("timeout"); timeout != "" {
+		opts.Timeout, err = time.ParseDuration(timeout)
+		if err != nil || opts.Timeout <= 0 {
+			return opts, fmt.Errorf("--timeout needs a duration like 30s or 5m, got '%s'", timeout)
+		}
+	}
+
+	return opts, nil
+}
+
+// outputType validates the output flag of cmd and stores it in the
+// config.
+func outputType(cmd *argparser.Command, finderconfig *config.Config) error {
+	output := cmd.GetString("output")
+	if output == "" {
+		return nil
+	}
+	if !search.IsOutputType(output) {
+		return fmt.Errorf("unknown output type '%s', use one of: %s",
+			output, strings.Join(search.OutputTypes, ", "))
+	}
+	finderconfig.OutputType = output
+	return nil
+}
+
+// intFlag returns the value of a string flag parsed as a non-negative
+// number. An unset flag returns 0.
+func intFlag(cmd *argparser.Command, name string) (int, error) {
+	value := cmd.GetString(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("--%s needs a number >= 0, got '%s'", name, value)
+	}
+	return n, nil
+}
+
+// Exit codes for searches which were stopped early
+const (
+	ExitTimeout     = 124 // like timeout(1)
+	ExitInterrupted = 130 // 128 + SIGINT
+)
+
+// exitCode returns the exit code for an error returned by a search.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitTimeout
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
 	}
+	return 1
 }
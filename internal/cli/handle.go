@@ -1,9 +1,14 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"text/tabwriter"
 
@@ -16,51 +21,106 @@ import (
 	"github.com/shadowdara/finder/pub/goansi"
 )
 
-// Function to search for a Template
-func Search(searchTemplate string, OutputType string, Verbose bool) error {
+// Function to search for one or more Templates. All templates are
+// searched during a single walk. The error is only set when the search
+// was stopped early by ctx or the timeout.
+func Search(ctx context.Context, searchTemplates []string, OutputType string, Verbose bool, opts search.Options) error {
+	searchList, ok := loadTemplates(searchTemplates)
+	if !ok {
+		return nil
+	}
+
+	return findTemplates(ctx, searchList, OutputType, Verbose, opts)
+}
+
+// findTemplates searches with already loaded templates in a single walk.
+func findTemplates(ctx context.Context, searchList []search.Template, OutputType string, Verbose bool, opts search.Options) error {
 	if Verbose {
 		fmt.Printf("%sStruct Finder %s%s - Buildtime: %s\n", color.Green, finderversion.Version, color.Reset, finderversion.BuildTime)
 	}
 
-	templateName := searchTemplate
+	if OutputType == "normal" && !opts.Executes() {
+		names := make([]string, len(searchList))
+		for i, t := range searchList {
+			names[i] = t.Name
+		}
+		fmt.Printf("Searching for %s ...\n", strings.Join(names, ", "))
+	}
+	return search.FindAll(ctx, searchList, OutputType, opts)
+}
 
+// loadTemplates loads the named templates. When one does not exist the
+// available templates are printed and ok is false.
+func loadTemplates(names []string) (list []search.Template, ok bool) {
 	// Load all templates (built-in + custom)
 	templateNames, userTemplates, err := templates.LoadAllWithUserTemplates()
 	if err != nil {
 		log.Fatalf("%sCould not load templates: %v%s\n", color.Red, err, color.Reset)
 	}
 
-	// Try to load with user templates first (they can override built-in ones)
-	data, err := templates.JSONtemplateLoaderWithUserTemplates(templateName, userTemplates)
-	if err != nil {
-		// Template not found - provide helpful error message
-		fmt.Printf("%sTemplate '%s' not found.%s\n", color.Red, templateName, color.Reset)
-		fmt.Printf("Available templates: %s\n", color.Yellow)
-		for i, t := range templateNames {
-			if i > 0 {
-				fmt.Print(", ")
-			}
-			fmt.Print(t)
+	for _, templateName := range names {
+		// Try to load with user templates first (they can override built-in ones)
+		data, err := templates.JSONtemplateLoaderWithUserTemplates(templateName, userTemplates)
+		if err != nil {
+			// Template not found - provide helpful error message
+			printTemplateNotFound(templateName, templateNames)
+			return nil, false
 		}
-		fmt.Printf("%s\n", color.Reset)
-		return nil
-	}
 
-	if OutputType != "clear" {
-		fmt.Printf("Searching for %s ...\n", templateName)
+		list = append(list, search.Template{
+			Name:   templateName,
+			Folder: structure.LoadJSON5(string(data)),
+		})
 	}
-	search.Find(structure.LoadJSON5(string(data)), OutputType)
 
-	return nil
+	return list, true
 }
 
-// Function to search for tags
-func TagSearch(searchTag string, OutputType string, Verbose bool) error {
-	if Verbose {
-		fmt.Printf("%sStruct Finder v%s%s\n", color.Green, finderversion.Version, color.Reset)
-		fmt.Printf("Searching for templates with tag '%s'...\n", searchTag)
+// printTemplateNotFound tells the user that a template does not exist
+// and lists the available ones.
+func printTemplateNotFound(templateName string, templateNames []string) {
+	fmt.Printf("%sTemplate '%s' not found.%s\n", color.Red, templateName, color.Reset)
+	fmt.Printf("Available templates: %s\n", color.Yellow)
+	for i, t := range templateNames {
+		if i > 0 {
+			fmt.Print(", ")
+		}
+		fmt.Print(t)
 	}
+	fmt.Printf("%s\n", color.Reset)
+}
+
+// loadTemplate loads a single built-in or custom template. When it does
+// not exist the available templates are printed and ok is false.
+func loadTemplate(templateName string) (template search.Template, ok bool) {
+	templateNames, userTemplates, err := templates.LoadAllWithUserTemplates()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: %v%s\n", color.Yellow, err, color.Reset)
+	}
+
+	data, err := templates.JSONtemplateLoaderWithUserTemplates(templateName, userTemplates)
+	if err != nil {
+		printTemplateNotFound(templateName, templateNames)
+		return search.Template{}, false
+	}
+
+	return search.Template{
+		Name:   templateName,
+		Folder: structure.LoadJSON5(string(data)),
+	}, true
+}
 
+// taggedTemplate is a template which carries a searched tag.
+type taggedTemplate struct {
+	name   string
+	tags   []string
+	source string
+	folder structure.Folder
+}
+
+// templatesWithTag loads all templates and returns the ones which carry
+// searchTag.
+func templatesWithTag(searchTag string, Verbose bool) []taggedTemplate {
 	// Load all templates
 	templateNames, userTemplates, err := templates.LoadAllWithUserTemplates()
 	if err != nil {
@@ -68,11 +128,7 @@ func TagSearch(searchTag string, OutputType string, Verbose bool) error {
 	}
 
 	// Find templates with the requested tag
-	matchingTemplates := []struct {
-		name   string
-		tags   []string
-		source string
-	}{}
+	matchingTemplates := []taggedTemplate{}
 
 	for _, templ := range templateNames {
 		// Try to load with user templates first
@@ -94,20 +150,49 @@ func TagSearch(searchTag string, OutputType string, Verbose bool) error {
 					source = "Custom"
 				}
 
-				matchingTemplates = append(matchingTemplates, struct {
-					name   string
-					tags   []string
-					source string
-				}{
+				matchingTemplates = append(matchingTemplates, taggedTemplate{
 					name:   templ,
 					tags:   folder.Tags,
 					source: source,
+					folder: folder,
 				})
 				break
 			}
 		}
 	}
 
+	return matchingTemplates
+}
+
+// Function to search the filesystem with every template which carries
+// the tag. All templates are searched in one walk and the results are
+// grouped by template.
+func TagSearchFind(ctx context.Context, searchTag string, OutputType string, Verbose bool, opts search.Options) error {
+	matchingTemplates := templatesWithTag(searchTag, Verbose)
+	if len(matchingTemplates) == 0 {
+		fmt.Printf("%sNo templates found with tag '%s'%s\n", color.Yellow, searchTag, color.Reset)
+		return nil
+	}
+
+	// The templates are already parsed, do not load them again
+	searchList := []search.Template{}
+	for _, tmpl := range matchingTemplates {
+		searchList = append(searchList, search.Template{Name: tmpl.name, Folder: tmpl.folder})
+	}
+
+	opts.Group = true
+	return findTemplates(ctx, searchList, OutputType, Verbose, opts)
+}
+
+// Function to search for tags
+func TagSearch(searchTag string, OutputType string, Verbose bool) error {
+	if Verbose {
+		fmt.Printf("%sStruct Finder v%s%s\n", color.Green, finderversion.Version, color.Reset)
+		fmt.Printf("Searching for templates with tag '%s'...\n", searchTag)
+	}
+
+	matchingTemplates := templatesWithTag(searchTag, Verbose)
+
 	// Display results
 	if len(matchingTemplates) == 0 {
 		fmt.Printf("%sNo templates found with tag '%s'%s\n", color.Yellow, searchTag, color.Reset)
@@ -176,6 +261,291 @@ func TagSearch(searchTag string, OutputType string, Verbose bool) error {
 	return nil
 }
 
+// detectedTemplate is a template matched by Detect.
+type detectedTemplate struct {
+	Name        string   `json:"name"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	Source      string   `json:"source"`
+}
+
+// Function to detect which templates the directory dir matches. Only dir
+// itself is checked, the directories below are not searched.
+func Detect(ctx context.Context, dir string, OutputType string) error {
+	templateNames, userTemplates, err := templates.LoadAllWithUserTemplates()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: %v%s\n", color.Yellow, err, color.Reset)
+	}
+
+	var searchList []search.Template
+	for _, templ := range templateNames {
+		data, err := templates.JSONtemplateLoaderWithUserTemplates(templ, userTemplates)
+		if err != nil {
+			continue
+		}
+		searchList = append(searchList, search.Template{
+			Name:   templ,
+			Folder: structure.LoadJSON5(string(data)),
+		})
+	}
+
+	matched, err := search.Detect(ctx, dir, searchList)
+	if err != nil {
+		return err
+	}
+
+	detected := []detectedTemplate{}
+	for _, t := range matched {
+		source := "Built-in"
+		if _, isCustom := userTemplates[t.Name]; isCustom {
+			source = "Custom"
+		}
+
+		tags := t.Folder.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		detected = append(detected, detectedTemplate{
+			Name:        t.Name,
+			Tags:        tags,
+			Description: t.Folder.Description,
+			Source:      source,
+		})
+	}
+
+	switch OutputType {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(detected)
+	case "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range detected {
+			if err := enc.Encode(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "clear":
+		for _, d := range detected {
+			fmt.Println(d.Name)
+		}
+		return nil
+	}
+
+	if len(detected) == 0 {
+		fmt.Printf("%sNo template matches '%s'%s\n", color.Yellow, dir, color.Reset)
+		return nil
+	}
+
+	fmt.Printf("%s'%s' matches %d templates:%s\n", color.Green, dir, len(detected), color.Reset)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%sTemplate%s\tTags\tSource\tDescription\n", color.Yellow, color.Reset)
+	for _, d := range detected {
+		fmt.Fprintf(w, "%s%s%s\t%s\t%s\t%s\n", color.Cyan, d.Name, color.Reset,
+			strings.Join(d.Tags, ", "), d.Source, d.Description)
+	}
+	w.Flush()
+
+	return nil
+}
+
+// Function to explain why the directory dir does or does not match a
+// template. Every rule is printed with its result and the values seen.
+// matched is false when the directory does not match.
+func Explain(ctx context.Context, templateName string, dir string, OutputType string) (matched bool, err error) {
+	template, ok := loadTemplate(templateName)
+	if !ok {
+		return false, nil
+	}
+
+	exp, err := search.Explain(ctx, dir, template)
+	if err != nil {
+		return false, err
+	}
+
+	switch OutputType {
+	case "json", "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		if OutputType == "json" {
+			enc.SetIndent("", "  ")
+		}
+		return exp.Matched, enc.Encode(exp)
+	}
+
+	fmt.Printf("Explaining template '%s' for %s\n\n", exp.Template, exp.Path)
+	for _, step := range exp.Steps {
+		result := color.Green + "PASS" + color.Reset
+		if !step.Passed {
+			result = color.Red + "FAIL" + color.Reset
+		}
+
+		line := step.Rule
+		if step.Detail != "" {
+			line += ": " + step.Detail
+		}
+		fmt.Printf("%s%s  %s\n", strings.Repeat("    ", step.Depth), result, line)
+	}
+
+	fmt.Println()
+	if exp.Matched {
+		fmt.Printf("%sThe directory matches '%s' with score %d%s\n", color.Green, exp.Template, exp.Score, color.Reset)
+	} else {
+		fmt.Printf("%sThe directory does not match '%s'%s\n", color.Red, exp.Template, color.Reset)
+	}
+
+	return exp.Matched, nil
+}
+
+// Function to run a command in every directory matching one of the
+// templates and print the outcome of every command.
+func Run(ctx context.Context, templateNames []string, argv []string, OutputType string, opts search.Options) error {
+	list, ok := loadTemplates(templateNames)
+	if !ok {
+		return nil
+	}
+	return search.Run(ctx, list, argv, OutputType, opts)
+}
+
+// Function to find the directories enclosing the current directory which
+// match a template, like git rev-parse --show-toplevel for any template.
+// Only the nearest one is printed unless all is set. found is false when
+// no directory matches.
+func Up(ctx context.Context, templateName string, all bool, OutputType string) (found bool, err error) {
+	template, ok := loadTemplate(templateName)
+	if !ok {
+		return false, nil
+	}
+
+	matches, err := search.Up(ctx, ".", template, all)
+	if err != nil {
+		return false, err
+	}
+
+	switch OutputType {
+	case "json":
+		paths := []string{}
+		for _, m := range matches {
+			paths = append(paths, filepath.ToSlash(m))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return len(matches) > 0, enc.Encode(paths)
+	case "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		for _, m := range matches {
+			if err := enc.Encode(filepath.ToSlash(m)); err != nil {
+				return true, err
+			}
+		}
+		return len(matches) > 0, nil
+	}
+
+	for _, m := range matches {
+		fmt.Println(m)
+	}
+	return len(matches) > 0, nil
+}
+
+// Watch prints the directories below dir which start or stop matching
+// the template until ctx is done.
+func Watch(ctx context.Context, templateName string, dir string, OutputType string, opts search.Options) error {
+	template, ok := loadTemplate(templateName)
+	if !ok {
+		return nil
+	}
+
+	return search.Watch(ctx, template, dir, OutputType, opts)
+}
+
+// IndexBuild indexes all directories below the roots of opts and
+// replaces the old index.
+func IndexBuild(ctx context.Context, opts search.Options) error {
+	path, err := search.DefaultIndexPath()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	ix := search.NewIndex(path, opts.Roots)
+	stats, err := ix.Refresh(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Indexed %d directories in %.2f seconds\n", stats.Dirs, time.Since(start).Seconds())
+	fmt.Printf("Index: %s\n", ix.Path())
+	return nil
+}
+
+// IndexUpdate reads the directories of the index again which were
+// changed since they were indexed.
+func IndexUpdate(ctx context.Context, opts search.Options) error {
+	path, err := search.DefaultIndexPath()
+	if err != nil {
+		return err
+	}
+	ix, err := search.LoadIndex(path)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	stats, err := ix.Refresh(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %d directories (%d read again, %d removed) in %.2f seconds\n",
+		stats.Dirs, stats.Read, stats.Removed, time.Since(start).Seconds())
+	return nil
+}
+
+// IndexStatus prints where the index is, what it contains and how much
+// of it is out of date.
+func IndexStatus() error {
+	path, err := search.DefaultIndexPath()
+	if err != nil {
+		return err
+	}
+	ix, err := search.LoadIndex(path)
+	if err != nil {
+		return err
+	}
+
+	size := int64(0)
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Index:\t%s (%d KB)\n", ix.Path(), size/1024)
+	for _, root := range ix.Roots {
+		fmt.Fprintf(w, "Root:\t%s\n", root)
+	}
+	fmt.Fprintf(w, "Directories:\t%d\n", len(ix.Dirs))
+	fmt.Fprintf(w, "Entries:\t%d\n", ix.Entries())
+	fmt.Fprintf(w, "Updated:\t%s\n", ix.Updated.Format("2006-01-02 15:04:05"))
+	w.Flush()
+
+	if stale := ix.Stale(); stale > 0 {
+		fmt.Printf("%s%d directories changed since the last update, run 'finder index update'%s\n",
+			color.Yellow, stale, color.Reset)
+	} else {
+		fmt.Printf("%sThe index is up to date%s\n", color.Green, color.Reset)
+	}
+	return nil
+}
+
 // handleCheck validates all templates
 func Check() error {
 
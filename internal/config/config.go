@@ -1,11 +1,35 @@
 package config
 
+import (
+	"os"
+	"path/filepath"
+)
+
 type Config struct {
 	OutputType string
+	Roots      []string // Default search roots, can be set with FINDER_ROOT
 }
 
 func NewConfig() Config {
 	return Config{
 		OutputType: "normal",
+		Roots:      defaultRoots(),
+	}
+}
+
+// defaultRoots returns the roots from the FINDER_ROOT environment
+// variable (a list separated like PATH) or the current directory.
+func defaultRoots() []string {
+	if env := os.Getenv("FINDER_ROOT"); env != "" {
+		var roots []string
+		for _, root := range filepath.SplitList(env) {
+			if root != "" {
+				roots = append(roots, root)
+			}
+		}
+		if len(roots) > 0 {
+			return roots
+		}
 	}
+	return []string{"."}
 }
@@ -8,6 +8,12 @@ func GetBlockedTemplateNames() map[string]string {
 		"ls": "same as list",
 		"tags": "display all tags in the console",
 		"tag": "same as tags",
+		"detect": "show which templates a directory matches",
+		"explain": "show why a directory matches a template or not",
+		"up": "find the enclosing directory which matches a template",
+		"run": "run a command in every matching directory",
+		"index": "build and update the directory index",
+		"watch": "print directories which start or stop matching a template",
 	}
 
 	return m
@@ -19,7 +19,7 @@ func TestGetBlockedTemplateNames_ReturnsMap(t *testing.T) {
 func TestGetBlockedTemplateNames_ContainsExpectedKeys(t *testing.T) {
 	blocked := GetBlockedTemplateNames()
 
-	expectedKeys := []string{"check", "help", "list", "ls", "tags", "tag"}
+	expectedKeys := []string{"check", "help", "list", "ls", "tags", "tag", "detect", "explain", "up", "run"}
 
 	for _, key := range expectedKeys {
 		if _, exists := blocked[key]; !exists {
@@ -110,11 +110,11 @@ func TestGetBlockedTemplateNames_TagKey(t *testing.T) {
 		t.Errorf("expected description %q for tag, got %q", expectedDesc, desc)
 	}
 }
-func TestGetBlockedTemplateNames_SizeSix(t *testing.T) {
+func TestGetBlockedTemplateNames_Size(t *testing.T) {
 	blocked := GetBlockedTemplateNames()
 
-	if len(blocked) != 6 {
-		t.Errorf("expected exactly 6 blocked names, got %d", len(blocked))
+	if len(blocked) != 12 {
+		t.Errorf("expected exactly 12 blocked names, got %d", len(blocked))
 	}
 }
 
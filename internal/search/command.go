@@ -0,0 +1,239 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+// shellCommand returns a command which runs command in the shell of the
+// system: cmd on Windows, sh everywhere else.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/c", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// runCommand runs cmd and returns its stdout. When ctx is done the
+// command is killed together with all processes it started, so a
+// hanging child can not keep the search waiting.
+func runCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := waitCommand(ctx, cmd)
+	return stdout.Bytes(), err
+}
+
+// waitCommand starts cmd and waits for it. When ctx is done the command
+// is killed together with all processes it started.
+func waitCommand(ctx context.Context, cmd *exec.Cmd) error {
+	prepareCommand(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killCommand(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+
+	return err
+}
+
+// commandRunner runs the commands of templates. It bounds the number of
+// commands running at the same time independent of the number of walk
+// workers and kills commands which run longer than the timeout.
+type commandRunner struct {
+	timeout time.Duration
+	slots   chan struct{} // nil means no limit
+}
+
+// newCommandRunner returns a runner with the command limits of opts.
+func newCommandRunner(opts Options) *commandRunner {
+	jobs := opts.CommandJobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	return &commandRunner{
+		timeout: opts.CommandTimeout,
+		slots:   make(chan struct{}, jobs),
+	}
+}
+
+// run runs the command of template t in dirPath and checks its outcome
+// with the command_mode of the template:
+//
+//	""                the old check: more than 0 bytes of output, more than
+//	                  1 byte with invert_command, the exit status is ignored
+//	exit_code         the exit status equals expected_exit_code (default 0)
+//	stdout_nonempty   the output contains more than whitespace
+//	stdout_matches    the output matches the regular expression command_pattern
+//
+// The stdout modes also check the exit status when expected_exit_code is
+// set. For all modes but the old one invert_command negates the result.
+// An empty command is always successful. The command gets the matched
+// directory, the template name and the search root in FINDER_MATCH_PATH,
+// FINDER_TEMPLATE and FINDER_ROOT. The outcome is recorded in tr.
+func (r *commandRunner) run(ctx context.Context, t Template, root, dirPath string, tr *trace) bool {
+	template := t.Folder
+	if template.Command == "" {
+		return true
+	}
+
+	rule := "command " + quote(template.Command)
+	if template.CommandMode != "" {
+		rule += " (" + template.CommandMode + ")"
+	}
+	if template.InvertCommand {
+		rule += " (inverted)"
+	}
+
+	// Wait for a free slot
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+			defer func() { <-r.slots }()
+		case <-ctx.Done():
+			tr.add(false, rule, "stopped: "+ctx.Err().Error())
+			return false
+		}
+	}
+
+	cmdCtx := ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	cmd := shellCommand(template.Command)
+	cmd.Dir = dirPath
+	cmd.Env = append(os.Environ(),
+		"FINDER_MATCH_PATH="+dirPath,
+		"FINDER_TEMPLATE="+t.Name,
+		"FINDER_ROOT="+root,
+	)
+
+	output, err := runCommand(cmdCtx, cmd)
+	if ctx.Err() != nil {
+		tr.add(false, rule, "stopped: "+ctx.Err().Error())
+		return false
+	}
+	if cmdCtx.Err() != nil {
+		tr.add(false, rule, fmt.Sprintf("killed after the command timeout of %s", r.timeout))
+		return false
+	}
+
+	code := exitCode(err)
+	status := fmt.Sprintf("exit status %d", code)
+	if code < 0 {
+		status = err.Error()
+	}
+
+	ok, want := checkCommand(template, output, code)
+	if template.CommandMode != "" && template.InvertCommand {
+		ok = !ok
+	}
+	tr.add(ok, rule, fmt.Sprintf("%s, %d bytes of output, needs %s", status, len(output), want))
+
+	return ok
+}
+
+// checkCommand checks the output and exit code of a template command
+// against its command_mode. want describes the check for a trace.
+func checkCommand(template structure.Folder, output []byte, code int) (ok bool, want string) {
+	if template.CommandMode == "" {
+		// Get the wanted return Vale from the Template
+		returnVal := 0
+		if template.InvertCommand {
+			returnVal = 1
+		}
+		return len(output) > returnVal, fmt.Sprintf("more than %d", returnVal)
+	}
+
+	expected := 0
+	if template.ExitCode != nil {
+		expected = *template.ExitCode
+	}
+	codeOK := code == expected
+	if template.CommandMode != "exit_code" && template.ExitCode == nil {
+		codeOK = true
+	}
+
+	switch template.CommandMode {
+	case "exit_code":
+		return codeOK, fmt.Sprintf("exit status %d", expected)
+	case "stdout_nonempty":
+		want = "non-empty output"
+		ok = len(bytes.TrimSpace(output)) > 0
+	case "stdout_matches":
+		want = "output matching " + quote(template.CommandMatch)
+		re, err := compilePattern(template.CommandMatch)
+		if err != nil {
+			return false, want + " (" + err.Error() + ")"
+		}
+		ok = re.Match(output)
+	default:
+		return false, "a known command_mode"
+	}
+
+	if template.ExitCode != nil {
+		want += fmt.Sprintf(" and exit status %d", expected)
+	}
+	return ok && codeOK, want
+}
+
+// exitCode returns the exit status of a finished command, -1 when it
+// could not be started or was killed by a signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// patterns caches the compiled command_pattern of the templates, the
+// same pattern is used for every directory of a search.
+var patterns = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+
+	if re, ok := patterns.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.m[pattern] = re
+	return re, nil
+}
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestCheckCommand(t *testing.T) {
+	zero, three := 0, 3
+
+	cases := []struct {
+		name     string
+		template structure.Folder
+		output   string
+		code     int
+		want     bool
+	}{
+		{"old mode ignores exit code", structure.Folder{}, "x", 1, true},
+		{"old mode needs output", structure.Folder{}, "", 0, false},
+		{"old inverted needs 2 bytes", structure.Folder{InvertCommand: true}, "x", 0, false},
+		{"exit code default 0", structure.Folder{CommandMode: "exit_code"}, "", 0, true},
+		{"exit code fails", structure.Folder{CommandMode: "exit_code"}, "output", 1, false},
+		{"expected exit code", structure.Folder{CommandMode: "exit_code", ExitCode: &three}, "", 3, true},
+		{"nonempty", structure.Folder{CommandMode: "stdout_nonempty"}, "a\n", 1, true},
+		{"nonempty only whitespace", structure.Folder{CommandMode: "stdout_nonempty"}, " \n", 0, false},
+		{"nonempty with exit code", structure.Folder{CommandMode: "stdout_nonempty", ExitCode: &zero}, "a", 1, false},
+		{"matches", structure.Folder{CommandMode: "stdout_matches", CommandMatch: `^v\d+`}, "v12\n", 0, true},
+		{"does not match", structure.Folder{CommandMode: "stdout_matches", CommandMatch: `^v\d+`}, "x", 0, false},
+		{"invalid pattern", structure.Folder{CommandMode: "stdout_matches", CommandMatch: `(`}, "(", 0, false},
+		{"unknown mode", structure.Folder{CommandMode: "other"}, "x", 0, false},
+	}
+
+	for _, c := range cases {
+		if got, _ := checkCommand(c.template, []byte(c.output), c.code); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRunTemplateCommand_Modes(t *testing.T) {
+	dir := t.TempDir()
+	three := 3
+
+	cases := []struct {
+		template structure.Folder
+		want     bool
+	}{
+		{structure.Folder{Command: "exit 0", CommandMode: "exit_code"}, true},
+		{structure.Folder{Command: "exit 1", CommandMode: "exit_code"}, false},
+		{structure.Folder{Command: "exit 1", CommandMode: "exit_code", InvertCommand: true}, true},
+		{structure.Folder{Command: "exit 3", CommandMode: "exit_code", ExitCode: &three}, true},
+		{structure.Folder{Command: "echo hello", CommandMode: "stdout_matches", CommandMatch: "hel+o"}, true},
+		{structure.Folder{Command: "echo hello", CommandMode: "stdout_nonempty", InvertCommand: true}, false},
+	}
+
+	for _, c := range cases {
+		if got := (&commandRunner{}).run(context.Background(), Template{Folder: c.template}, dir, dir, nil); got != c.want {
+			t.Errorf("%q (%s, inverted %v): expected %v, got %v",
+				c.template.Command, c.template.CommandMode, c.template.InvertCommand, c.want, got)
+		}
+	}
+}
+
+func TestCommandRunner_Timeout(t *testing.T) {
+	command := "sleep 5"
+	if runtime.GOOS == "windows" {
+		command = "ping -n 6 127.0.0.1"
+	}
+
+	r := newCommandRunner(Options{CommandTimeout: 100 * time.Millisecond})
+	tr := &trace{}
+
+	start := time.Now()
+	if r.run(context.Background(), Template{Folder: structure.Folder{Command: command}}, t.TempDir(), t.TempDir(), tr) {
+		t.Fatalf("expected a command which timed out not to match")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected the command to be killed at the command timeout")
+	}
+	if len(tr.steps) != 1 || !strings.Contains(tr.steps[0].Detail, "command timeout") {
+		t.Errorf("expected the timeout in the trace, got %+v", tr.steps)
+	}
+}
+
+func TestCommandRunner_Environment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "proj")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	tpl := Template{Name: "env", Folder: structure.Folder{
+		Command:      `echo "$FINDER_MATCH_PATH|$FINDER_TEMPLATE|$FINDER_ROOT"`,
+		CommandMode:  "stdout_matches",
+		CommandMatch: "^" + regexp.QuoteMeta(dir+"|env|"+root) + "\n$",
+	}}
+
+	if !(&commandRunner{}).run(context.Background(), tpl, root, dir, nil) {
+		t.Fatalf("expected the command to see the finder environment variables")
+	}
+}
+
+func TestWalker_CommandJobsLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	root := t.TempDir()
+	var dirs []string
+	for i := 0; i < 8; i++ {
+		dirs = append(dirs, fmt.Sprintf("repo%d", i))
+	}
+	makeGitRepos(t, root, dirs...)
+
+	// Fails when another command holds the lock at the same time
+	tpl := gitTemplate
+	tpl.Command = `mkdir "$FINDER_ROOT/lock" && sleep 0.02 && rmdir "$FINDER_ROOT/lock"`
+	tpl.CommandMode = "exit_code"
+
+	matches := findMatchingFolders(context.Background(), root, tpl, Options{Jobs: 8, CommandJobs: 1})
+	if len(matches) != len(dirs) {
+		t.Fatalf("expected all %d commands to run one after another, got %v", len(dirs), matches)
+	}
+}
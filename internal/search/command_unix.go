@@ -0,0 +1,19 @@
+//go:build !windows
+
+package search
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand starts the command in its own process group so that
+// killCommand can stop the shell and everything it started.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killCommand kills the process group of a started command.
+func killCommand(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package search
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// prepareCommand does nothing on Windows, killCommand uses taskkill to
+// stop the whole process tree instead.
+func prepareCommand(cmd *exec.Cmd) {}
+
+// killCommand kills a started command and all of its child processes.
+func killCommand(cmd *exec.Cmd) {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
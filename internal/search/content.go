@@ -0,0 +1,150 @@
+package search
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shadowdara/finder/internal/structure"
+	"github.com/shadowdara/finder/pub/manifest"
+)
+
+// contentLimit is how many bytes at the start of a file are read for
+// the contains, matches and keys rules, so big files do not slow down the
+// walk. Text after the limit is not checked.
+const contentLimit = 256 * 1024
+
+// hasContentRule reports whether the file rule checks the content.
+func hasContentRule(file structure.File) bool {
+	return file.Contains != "" || file.Matches != "" || len(file.Keys) > 0
+}
+
+// contentLast returns the file rules with the rules which read the
+// content at the end, so they are skipped when a cheaper rule fails.
+func contentLast(files structure.Files) structure.Files {
+	sorted := make(structure.Files, 0, len(files))
+	for _, f := range files {
+		if !hasContentRule(f) {
+			sorted = append(sorted, f)
+		}
+	}
+	for _, f := range files {
+		if hasContentRule(f) {
+			sorted = append(sorted, f)
+		}
+	}
+	return sorted
+}
+
+// contentRule describes the content rules of a file for explain.
+func contentRule(file structure.File) string {
+	var rules []string
+	if file.Contains != "" {
+		rules = append(rules, "containing "+quote(file.Contains))
+	}
+	if file.Matches != "" {
+		rules = append(rules, "matching /"+file.Matches+"/")
+	}
+	for _, k := range file.Keys {
+		switch {
+		case k.Equals != "":
+			rules = append(rules, "with "+quote(k.Path)+" = "+quote(k.Equals))
+		case k.Matches != "":
+			rules = append(rules, "with "+quote(k.Path)+" matching /"+k.Matches+"/")
+		default:
+			rules = append(rules, "with key "+quote(k.Path))
+		}
+	}
+	return strings.Join(rules, " and ")
+}
+
+// matchContent returns the first of the files in dirPath whose name
+// matches the rule and which has the content of the rule, "" when there
+// is none. checked are the names of the files which were read.
+func matchContent(dirPath string, files map[string]bool, file structure.File) (name string, checked []string) {
+	checked = matchingNames(files, file.Name)
+	for _, name := range checked {
+		if checkContent(filepath.Join(dirPath, name), file) {
+			return name, checked
+		}
+	}
+	return "", checked
+}
+
+// contentDetail describes the result of matchContent for explain.
+func contentDetail(name string, checked []string) string {
+	if name != "" {
+		return "found " + quote(name) + " with matching content"
+	}
+
+	quoted := make([]string, len(checked))
+	for i, name := range checked {
+		quoted[i] = quote(name)
+	}
+	return "content does not match in " + strings.Join(quoted, ", ")
+}
+
+// checkContent reads the start of the file at filePath and checks it
+// against the contains, matches and keys rules. For keys the file is
+// parsed, a file which is cut off at contentLimit does not parse. A
+// file which can not be read does not match.
+func checkContent(filePath string, file structure.File) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, contentLimit))
+	if err != nil {
+		return false
+	}
+
+	if file.Contains != "" && !bytes.Contains(data, []byte(file.Contains)) {
+		return false
+	}
+	if file.Matches != "" {
+		// ^ and $ match at every line
+		re, err := compilePattern("(?m)" + file.Matches)
+		if err != nil || !re.Match(data) {
+			return false
+		}
+	}
+	if len(file.Keys) > 0 {
+		format := file.Format
+		if format == "" {
+			format = manifest.FormatOf(filepath.Base(filePath))
+		}
+		doc, err := manifest.Parse(format, data)
+		if err != nil {
+			return false
+		}
+		for _, k := range file.Keys {
+			if !checkKey(doc, k) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkKey reports whether one of the values at the path of k exists and
+// fits its comparison.
+func checkKey(doc interface{}, k structure.Key) bool {
+	for _, v := range manifest.Lookup(doc, k.Path) {
+		text := manifest.String(v)
+		if k.Equals != "" && text != k.Equals {
+			continue
+		}
+		if k.Matches != "" {
+			re, err := compilePattern(k.Matches)
+			if err != nil || !re.MatchString(text) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestMatchFolderTemplate_FileContent(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package.json", `{"dependencies": {"react": "^18.0.0"}}`)
+	writeFile(t, dir, "Dockerfile", "# build\nFROM golang:1.22 AS build\nRUN go build\n")
+
+	cases := []struct {
+		name string
+		file structure.File
+		want bool
+	}{
+		{"contains", structure.File{Name: "package.json", Contains: `"react"`}, true},
+		{"contains missing text", structure.File{Name: "package.json", Contains: `"vue"`}, false},
+		{"matches a line", structure.File{Name: "Dockerfile", Matches: `^FROM golang`}, true},
+		{"matches only at line start", structure.File{Name: "Dockerfile", Matches: `^AS build`}, false},
+		{"contains and matches", structure.File{Name: "Dockerfile", Contains: "RUN", Matches: `golang:1\.\d+`}, true},
+		{"wildcard name", structure.File{Name: "*.json", Contains: "react"}, true},
+		{"missing file", structure.File{Name: "go.mod", Contains: "module"}, false},
+		{"forbidden content", structure.File{Name: "package.json", Existence: "forbidden", Contains: `"vue"`}, true},
+		{"forbidden content found", structure.File{Name: "package.json", Existence: "forbidden", Contains: `"react"`}, false},
+		{"optional content", structure.File{Name: "package.json", Existence: "optional", Contains: `"vue"`}, true},
+	}
+	for _, c := range cases {
+		tpl := structure.Folder{Files: structure.Files{c.file}}
+		if got := matchFolderTemplate(dir, tpl); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCheckContent_ReadLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	data := strings.Repeat("x", contentLimit) + "needle"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if checkContent(path, structure.File{Contains: "needle"}) {
+		t.Errorf("expected text after the read limit to be ignored")
+	}
+	if !checkContent(path, structure.File{Contains: "xxx"}) {
+		t.Errorf("expected text before the read limit to be found")
+	}
+}
+
+func TestExplain_FileContent(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tr := &trace{}
+	tpl := structure.Folder{Files: structure.Files{{Name: "package.json", Contains: "react"}}}
+	if matched, _ := matchFolder(dir, tpl, tr); matched {
+		t.Fatalf("expected no match")
+	}
+
+	want := `file 'package.json' (required) containing 'react'`
+	for _, step := range tr.steps {
+		if step.Rule == want {
+			if step.Passed || !strings.Contains(step.Detail, "content does not match") {
+				t.Errorf("expected a failed content rule, got %+v", step)
+			}
+			return
+		}
+	}
+	t.Errorf("expected the rule %q in %+v", want, tr.steps)
+}
+
+func TestMatchFolderTemplate_FileKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "package.json", `{"name": "web", "dependencies": {"react": "^18.2.0"}}`)
+	writeFile(t, dir, "pyproject.toml", "[tool.poetry]\nname = \"py\"\n")
+	writeFile(t, dir, "pubspec.yaml", "name: app\ndependencies:\n  flutter:\n    sdk: flutter\n")
+	writeFile(t, dir, "manifest", `{"kind": "plugin"}`)
+
+	cases := []struct {
+		name string
+		file structure.File
+		want bool
+	}{
+		{"json key", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "dependencies.react"}}}, true},
+		{"missing json key", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "dependencies.vue"}}}, false},
+		{"json equals", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "name", Equals: "web"}}}, true},
+		{"json equals other value", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "name", Equals: "api"}}}, false},
+		{"json regex", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "dependencies.react", Matches: `^\^18\.`}}}, true},
+		{"all keys", structure.File{Name: "package.json", Keys: []structure.Key{{Path: "name"}, {Path: "scripts"}}}, false},
+		{"toml table", structure.File{Name: "pyproject.toml", Keys: []structure.Key{{Path: "tool.poetry"}}}, true},
+		{"yaml key", structure.File{Name: "pubspec.yaml", Keys: []structure.Key{{Path: "dependencies.flutter.sdk", Equals: "flutter"}}}, true},
+		{"format by field", structure.File{Name: "manifest", Format: "json", Keys: []structure.Key{{Path: "kind", Equals: "plugin"}}}, true},
+		{"wrong format", structure.File{Name: "pubspec.yaml", Format: "json", Keys: []structure.Key{{Path: "name"}}}, false},
+	}
+	for _, c := range cases {
+		tpl := structure.Folder{Files: structure.Files{c.file}}
+		if got := matchFolderTemplate(dir, tpl); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMatchFolderTemplate_ContentSizeOfMatchingFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "Dockerfile", "FROM node\n"+strings.Repeat("RUN true\n", 1000))
+	writeFile(t, dir, "Dockerfile.go", "FROM golang\n")
+
+	// Only the file with the content has to fit the size
+	file := structure.File{Name: "Dockerfile*", Contains: "FROM golang", DataSize: structure.Size{Max: 1, Max_size_type: "KB"}}
+	if !matchFolderTemplate(dir, structure.Folder{Files: structure.Files{file}}) {
+		t.Errorf("expected the size of Dockerfile.go to be checked")
+	}
+
+	file.Contains = "FROM node"
+	if matchFolderTemplate(dir, structure.Folder{Files: structure.Files{file}}) {
+		t.Errorf("expected the size of Dockerfile to fail")
+	}
+}
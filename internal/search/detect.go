@@ -0,0 +1,43 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Detect checks the single directory dirPath against templates without
+// walking below it and returns the templates it matches, in the order
+// they were given. The template commands are run as in a search.
+func Detect(ctx context.Context, dirPath string, templates []Template) ([]Template, error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dirPath)
+	}
+	// The folder name of "." is the name of the working directory
+	if abs, err := filepath.Abs(dirPath); err == nil {
+		dirPath = abs
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := newCommandRunner(NewOptions())
+	matched := []Template{}
+	for _, t := range templates {
+		if ctx.Err() != nil {
+			return matched, ctx.Err()
+		}
+		if ok, _ := matchTemplate(ctx, commands, t, dirPath, dirPath, entries); ok {
+			matched = append(matched, t)
+		}
+	}
+
+	return matched, nil
+}
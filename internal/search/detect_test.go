@@ -0,0 +1,82 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestDetect(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "proj", "proj/sub")
+	proj := filepath.Join(root, "proj")
+	if err := os.WriteFile(filepath.Join(proj, "go.mod"), []byte("module x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	templates := []Template{
+		{Name: "npm", Folder: structure.Folder{Name: "*", Files: structure.Files{{Name: "package.json"}}}},
+		{Name: "go", Folder: structure.Folder{Name: "*", Files: structure.Files{{Name: "go.mod"}}}},
+		{Name: "git", Folder: gitTemplate},
+		{Name: "other", Folder: structure.Folder{Name: "other", Folders: []structure.Folder{{Name: ".git"}}}},
+	}
+
+	matched, err := Detect(context.Background(), proj, templates)
+	if err != nil {
+		t.Fatalf("Detect returned error: %v", err)
+	}
+	if len(matched) != 2 || matched[0].Name != "go" || matched[1].Name != "git" {
+		t.Fatalf("expected go and git in template order, got %v", matched)
+	}
+
+	// Only the directory itself is checked, not the directories below
+	matched, err = Detect(context.Background(), root, templates)
+	if err != nil {
+		t.Fatalf("Detect returned error: %v", err)
+	}
+	if len(matched) != 0 {
+		t.Fatalf("expected no match for the parent directory, got %v", matched)
+	}
+}
+
+func TestDetect_RelativePath(t *testing.T) {
+	proj := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(proj, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(proj); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	templates := []Template{{Name: "proj", Folder: structure.Folder{Name: "proj"}}}
+	matched, err := Detect(context.Background(), ".", templates)
+	if err != nil {
+		t.Fatalf("Detect returned error: %v", err)
+	}
+	if len(matched) != 1 {
+		t.Fatalf("expected the folder name of the working directory to match, got %v", matched)
+	}
+}
+
+func TestDetect_NotADirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := Detect(context.Background(), file, nil); err == nil {
+		t.Fatalf("expected an error for a file")
+	}
+	if _, err := Detect(context.Background(), filepath.Join(file, "missing"), nil); err == nil {
+		t.Fatalf("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,261 @@
+package search
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// IgnoreFileName is the name of the per-directory file with exclude
+// patterns. It uses the same syntax as a .gitignore file.
+const IgnoreFileName = ".finderignore"
+
+// defaultExcludes are directory names which are never worth searching.
+var defaultExcludes = []string{
+	"node_modules",
+	".cache",
+	".Trash",
+	".Trash-*",
+	".Trashes",
+	"$RECYCLE.BIN",
+	"System Volume Information",
+}
+
+// defaultExcludePaths returns absolute paths which are never searched,
+// like pseudo-filesystems and the trash bin.
+func defaultExcludePaths() []string {
+	var paths []string
+
+	if runtime.GOOS == "linux" {
+		paths = append(paths, "/proc", "/sys", "/dev", "/run")
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".local", "share", "Trash"))
+	}
+
+	return paths
+}
+
+// excludeRule is a single gitignore style pattern.
+type excludeRule struct {
+	base     string // directory the pattern is relative to
+	pattern  string // pattern with '/' as separator
+	negate   bool   // pattern started with '!'
+	anchored bool   // pattern contains a '/' and is matched against the relative path
+}
+
+// parseExcludeRule parses a gitignore style pattern relative to base.
+// It returns false for empty lines and comments.
+func parseExcludeRule(base, line string) (excludeRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return excludeRule{}, false
+	}
+
+	rule := excludeRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// Escaped leading '#' or '!'
+		line = line[1:]
+	}
+
+	// Only directories are walked, so a trailing slash changes nothing
+	line = strings.TrimSuffix(line, "/")
+	if line == "" {
+		return excludeRule{}, false
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	rule.pattern = line
+	return rule, true
+}
+
+// match reports whether the directory at dirPath matches the rule.
+func (r excludeRule) match(dirPath string) bool {
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, filepath.Base(dirPath))
+		return ok
+	}
+
+	if dirPath == r.base || !isWithin(r.base, dirPath) {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, dirPath)
+	if err != nil {
+		return false
+	}
+	return matchGlob(r.pattern, filepath.ToSlash(rel))
+}
+
+// matchGlob matches a slash separated name against a pattern. Besides
+// the path.Match syntax a "**" segment matches any number of segments.
+// Like in git a trailing "/**" only matches what is inside a directory,
+// not the directory itself.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// excluder decides which directories are pruned from the walk of one
+// root. It combines the default excludes and the --exclude patterns,
+// the skip lists of the templates are kept apart because they only
+// apply to their own template. Rules from .finderignore files are read
+// by ignoreRules and passed down the walk with each directory.
+type excluder struct {
+	root  string
+	paths map[string]bool
+	rules []excludeRule
+	skip  [][]excludeRule // skip rules per template
+}
+
+// newExcluder builds the excluder for a walk of root.
+func newExcluder(root string, templates []Template, opts Options) *excluder {
+	e := &excluder{
+		root:  root,
+		paths: map[string]bool{},
+	}
+
+	var patterns []string
+	if !opts.NoDefaultExcludes {
+		patterns = append(patterns, defaultExcludes...)
+		for _, p := range defaultExcludePaths() {
+			e.paths[p] = true
+		}
+	}
+	patterns = append(patterns, opts.Excludes...)
+	e.rules = parseExcludeRules(root, patterns)
+
+	for _, t := range templates {
+		e.skip = append(e.skip, parseExcludeRules(root, t.Folder.Skip))
+	}
+
+	return e
+}
+
+// parseExcludeRules parses patterns relative to base and drops empty
+// ones.
+func parseExcludeRules(base string, patterns []string) []excludeRule {
+	var rules []excludeRule
+	for _, p := range patterns {
+		if rule, ok := parseExcludeRule(base, p); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// excluded reports whether the directory dirPath below the root should
+// be skipped. ignore holds the rules of the ignore files of all parents.
+// The root itself is never excluded. Like in git the last matching rule
+// wins and rules from deeper ignore files win over rules from higher
+// ones.
+func (e *excluder) excluded(dirPath string, ignore []excludeRule) bool {
+	if dirPath == e.root {
+		return false
+	}
+	if e.paths[dirPath] {
+		return true
+	}
+
+	return matchRules(dirPath, false, e.rules, ignore)
+}
+
+// skipped reports whether the skip list of the template with index i
+// excludes dirPath.
+func (e *excluder) skipped(i int, dirPath string) bool {
+	return matchRules(dirPath, false, e.skip[i])
+}
+
+// matchRules applies lists of rules in order to dirPath, starting with
+// result. The last matching rule decides.
+func matchRules(dirPath string, result bool, lists ...[]excludeRule) bool {
+	for _, rules := range lists {
+		for _, rule := range rules {
+			if rule.match(dirPath) {
+				result = !rule.negate
+			}
+		}
+	}
+	return result
+}
+
+// ignoreRules returns the rules which apply to the subdirectories of dir:
+// the rules of its parents plus the rules of the ignore file in dir. The
+// file is only opened when entries contains it.
+func ignoreRules(dir string, entries []fs.DirEntry, parent []excludeRule) []excludeRule {
+	for _, e := range entries {
+		if e.Name() != IgnoreFileName || e.IsDir() {
+			continue
+		}
+
+		own := readIgnoreFile(dir)
+		if len(own) == 0 {
+			break
+		}
+
+		// Never append to the slice of the parent, siblings share it
+		rules := make([]excludeRule, 0, len(parent)+len(own))
+		rules = append(rules, parent...)
+		return append(rules, own...)
+	}
+
+	return parent
+}
+
+// readIgnoreFile parses the ignore file in dir. A missing file has no
+// rules.
+func readIgnoreFile(dir string) []excludeRule {
+	f, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []excludeRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseExcludeRule(dir, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,154 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+// makeGitRepos creates an empty .git folder in every dir below root.
+func makeGitRepos(t *testing.T, root string, dirs ...string) {
+	t.Helper()
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir, ".git"), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+}
+
+// writeFile creates the file name in dir with data.
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+var gitTemplate = structure.Folder{
+	Name:    "*",
+	Folders: []structure.Folder{{Name: ".git"}},
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/*", "a/b", true},
+		{"a/*", "a/b/c", false},
+		{"**/b", "a/x/b", true},
+		{"**/b", "b", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "a/b", true},
+		{"a/**", "a", false},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/d/c", true},
+		{"a/**/c", "a/b/d", false},
+	}
+
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.name); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseExcludeRule(t *testing.T) {
+	if _, ok := parseExcludeRule("/r", "# comment"); ok {
+		t.Errorf("expected comment to be ignored")
+	}
+	if _, ok := parseExcludeRule("/r", "   "); ok {
+		t.Errorf("expected blank line to be ignored")
+	}
+
+	rule, ok := parseExcludeRule("/r", "!/build/")
+	if !ok || !rule.negate || !rule.anchored || rule.pattern != "build" {
+		t.Errorf("unexpected rule: %#v", rule)
+	}
+
+	rule, ok = parseExcludeRule("/r", "vendor/")
+	if !ok || rule.anchored || rule.pattern != "vendor" {
+		t.Errorf("unexpected rule: %#v", rule)
+	}
+}
+
+func TestFindMatchingFolders_DefaultExcludes(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "app", "app/node_modules/dep")
+
+	matches := findMatchingFolders(context.Background(), root, gitTemplate, Options{})
+	if len(matches) != 1 {
+		t.Fatalf("expected node_modules to be skipped, got %v", matches)
+	}
+
+	matches = findMatchingFolders(context.Background(), root, gitTemplate, Options{NoDefaultExcludes: true})
+	if len(matches) != 2 {
+		t.Fatalf("expected node_modules to be searched, got %v", matches)
+	}
+}
+
+func TestFindMatchingFolders_ExcludeOption(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b", "vendor/c", "x/vendor/d")
+
+	matches := findMatchingFolders(context.Background(), root, gitTemplate, Options{Excludes: []string{"vendor"}})
+	if len(matches) != 2 {
+		t.Fatalf("expected every vendor dir to be skipped, got %v", matches)
+	}
+
+	// Patterns with a slash are relative to the root
+	matches = findMatchingFolders(context.Background(), root, gitTemplate, Options{Excludes: []string{"/vendor"}})
+	if len(matches) != 3 {
+		t.Fatalf("expected only the top vendor dir to be skipped, got %v", matches)
+	}
+}
+
+func TestFindMatchingFolders_TemplateSkip(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "archive/b")
+
+	tpl := gitTemplate
+	tpl.Skip = []string{"archive"}
+
+	matches := findMatchingFolders(context.Background(), root, tpl, Options{})
+	if len(matches) != 1 {
+		t.Fatalf("expected archive to be skipped, got %v", matches)
+	}
+}
+
+func TestFindMatchingFolders_IgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "sub/old", "sub/keep", "other/old")
+
+	ignore := "# old projects\nold\n!keep\n"
+	if err := os.WriteFile(filepath.Join(root, "sub", IgnoreFileName), []byte(ignore), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	matches := findMatchingFolders(context.Background(), root, gitTemplate, Options{})
+	if len(matches) != 3 {
+		t.Fatalf("expected only sub/old to be skipped, got %v", matches)
+	}
+	for _, m := range matches {
+		if m == filepath.Join(root, "sub", "old") {
+			t.Errorf("expected %q to be skipped", m)
+		}
+	}
+
+	// A deeper ignore file can re-include a directory
+	if err := os.WriteFile(filepath.Join(root, IgnoreFileName), []byte("keep\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", IgnoreFileName), []byte("!keep\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	matches = findMatchingFolders(context.Background(), root, gitTemplate, Options{})
+	if len(matches) != 4 {
+		t.Fatalf("expected sub/keep to be re-included, got %v", matches)
+	}
+}
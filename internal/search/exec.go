@@ -0,0 +1,251 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shadowdara/finder/pub/goansi"
+)
+
+// ExecError is returned when commands started with Options.Exec or
+// Options.ExecBatch failed.
+type ExecError struct {
+	Failed int
+	Total  int
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("%d of %d commands failed", e.Failed, e.Total)
+}
+
+// execResult is the outcome of a command run in one directory.
+type execResult struct {
+	Dir      string
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	Err      error // set when the command could not be run or was killed
+	Duration time.Duration
+	Ran      bool // false when the command was not started because ctx was done
+}
+
+// failed reports whether the command did not exit with 0.
+func (r execResult) failed() bool {
+	return r.Err != nil || r.ExitCode != 0
+}
+
+// userCommand returns a command the user runs on the results. Unlike a
+// template command it stays in the process group of finder and reads
+// its stdin, so commands which use the terminal work. It is killed when
+// ctx is done.
+func userCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// userShellCommand is userCommand for a command line run by the shell of
+// the system, like shellCommand.
+func userShellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return userCommand(ctx, "cmd", "/c", command)
+	}
+	return userCommand(ctx, "sh", "-c", command)
+}
+
+// runEach runs the command returned by command in every directory of
+// dirs, at most jobs at the same time. done is called for every finished
+// command, one call at a time. The results are returned in the order of
+// dirs. The commands have to be created with ctx, see userCommand.
+func runEach(ctx context.Context, dirs []string, jobs int, command func(dir string) *exec.Cmd, done func(execResult)) []execResult {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]execResult, len(dirs))
+	slots := make(chan struct{}, jobs)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			result := execResult{Dir: dir}
+			if ctx.Err() != nil {
+				result.ExitCode = -1
+				result.Err = ctx.Err()
+			} else {
+				var stdout, stderr bytes.Buffer
+				cmd := command(dir)
+				cmd.Stdout = &stdout
+				cmd.Stderr = &stderr
+
+				start := time.Now()
+				result.Ran = true
+				err := cmd.Run()
+				result.Duration = time.Since(start)
+				result.Stdout = stdout.Bytes()
+				result.Stderr = stderr.Bytes()
+				result.ExitCode = exitCode(err)
+				if result.ExitCode < 0 {
+					result.Err = err
+					if ctx.Err() != nil {
+						result.Err = ctx.Err()
+					}
+				}
+			}
+			results[i] = result
+
+			if done != nil {
+				mu.Lock()
+				done(result)
+				mu.Unlock()
+			}
+		}(i, dir)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runExec runs the --exec or --exec-batch command of opts for the
+// matches of a search.
+func runExec(ctx context.Context, matches []Result, opts Options) error {
+	dirs := resultPaths(matches)
+	if opts.ExecBatch != "" {
+		return execBatch(ctx, dirs, opts.ExecBatch)
+	}
+	return execEach(ctx, dirs, opts.Exec, opts.ExecJobs, os.Stdout, os.Stderr)
+}
+
+// execEach runs command in every directory of dirs with the placeholders
+// replaced by that directory. The output of every command is written
+// when it is finished, each line prefixed with its directory. A summary
+// of the failed commands is written to stderr.
+func execEach(ctx context.Context, dirs []string, command string, jobs int, stdout, stderr io.Writer) error {
+	results := runEach(ctx, dirs, jobs, func(dir string) *exec.Cmd {
+		cmd := userShellCommand(ctx, expandPlaceholders(command, dir))
+		cmd.Dir = dir
+		return cmd
+	}, func(r execResult) {
+		prefix := "[" + filepath.ToSlash(r.Dir) + "] "
+		writePrefixed(stdout, prefix, r.Stdout)
+		writePrefixed(stderr, prefix, r.Stderr)
+	})
+
+	return execSummary(results, stderr)
+}
+
+// execBatch runs command once with all dirs. The placeholders are
+// replaced by the list of all directories, without a placeholder the
+// directories are appended to the command. The output is not changed.
+func execBatch(ctx context.Context, dirs []string, command string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		quoted[i] = shellQuote(dir)
+	}
+	all := strings.Join(quoted, " ")
+
+	if strings.Contains(command, "{}") {
+		command = strings.ReplaceAll(command, "{}", all)
+	} else {
+		command += " " + all
+	}
+
+	if err := userShellCommand(ctx, command).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s[ERROR] %s: %v%s\n", goansi.RED, command, err, goansi.END)
+		return &ExecError{Failed: 1, Total: 1}
+	}
+	return nil
+}
+
+// execSummary writes the failed commands of results to w and returns an
+// ExecError when at least one failed.
+func execSummary(results []execResult, w io.Writer) error {
+	failed := 0
+	for _, r := range results {
+		if r.failed() {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s# %d of %d commands failed:%s\n", goansi.RED, failed, len(results), goansi.END)
+	for _, r := range results {
+		if !r.failed() {
+			continue
+		}
+		if r.Err != nil {
+			fmt.Fprintf(w, "%s  (%v)\n", filepath.ToSlash(r.Dir), r.Err)
+		} else {
+			fmt.Fprintf(w, "%s  (exit status %d)\n", filepath.ToSlash(r.Dir), r.ExitCode)
+		}
+	}
+
+	return &ExecError{Failed: failed, Total: len(results)}
+}
+
+// writePrefixed writes every line of data to w with prefix in front.
+func writePrefixed(w io.Writer, prefix string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		b.WriteString(prefix)
+		b.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+// expandPlaceholders replaces the placeholders in command with the quoted
+// parts of dir, like fd does:
+//
+//	{}    the directory
+//	{/}   the name of the directory
+//	{//}  the parent of the directory
+func expandPlaceholders(command, dir string) string {
+	r := strings.NewReplacer(
+		"{//}", shellQuote(filepath.Dir(dir)),
+		"{/}", shellQuote(filepath.Base(dir)),
+		"{}", shellQuote(dir),
+	)
+	return r.Replace(command)
+}
+
+// shellQuote quotes s as a single argument for the shell of shellCommand.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
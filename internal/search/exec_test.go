@@ -0,0 +1,130 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh quoting")
+	}
+
+	got := expandPlaceholders("echo {} {/} {//}", "/a/it's/b")
+	want := `echo '/a/it'\''s/b' 'b' '/a/it'\''s'`
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestWritePrefixed(t *testing.T) {
+	var b bytes.Buffer
+	writePrefixed(&b, "[x] ", []byte("one\ntwo"))
+	if b.String() != "[x] one\n[x] two\n" {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+}
+
+func TestExecEach(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+	dirs := []string{filepath.Join(root, "a"), filepath.Join(root, "b")}
+
+	var stdout, stderr bytes.Buffer
+	err := execEach(context.Background(), dirs, `echo {/}; test {/} = a`, 2, &stdout, &stderr)
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.Failed != 1 || execErr.Total != 2 {
+		t.Fatalf("expected 1 of 2 commands to fail, got %v", err)
+	}
+
+	out := stdout.String()
+	for _, dir := range dirs {
+		line := "[" + filepath.ToSlash(dir) + "] " + filepath.Base(dir) + "\n"
+		if !strings.Contains(out, line) {
+			t.Errorf("expected line %q in output %q", line, out)
+		}
+	}
+	if !strings.Contains(stderr.String(), filepath.ToSlash(dirs[1])+"  (exit status 1)") {
+		t.Errorf("expected the failed directory in the summary, got %q", stderr.String())
+	}
+}
+
+func TestExecEach_ReadsStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	input := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(input, []byte("yes\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	var stdout, stderr bytes.Buffer
+	dir := t.TempDir()
+	if err := execEach(context.Background(), []string{dir}, `read answer; echo "$answer"`, 1, &stdout, &stderr); err != nil {
+		t.Fatalf("execEach returned error: %v (%s)", err, stderr.String())
+	}
+	if want := "[" + filepath.ToSlash(dir) + "] yes\n"; stdout.String() != want {
+		t.Errorf("expected the command to read the stdin of finder, got %q", stdout.String())
+	}
+}
+
+func TestFindAll_Exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+
+	output := captureSearchOutput(func() {
+		err := FindAll(context.Background(), []Template{{Folder: gitTemplate}}, "normal",
+			Options{Roots: []string{root}, Exec: "touch ran"})
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	if output != "" {
+		t.Errorf("expected no search output with --exec, got %q", output)
+	}
+	for _, dir := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join(root, dir, "ran")); err != nil {
+			t.Errorf("expected the command to run in %s: %v", dir, err)
+		}
+	}
+
+	// Without a placeholder the directories are appended
+	list := filepath.Join(root, "list")
+	captureSearchOutput(func() {
+		FindAll(context.Background(), []Template{{Folder: gitTemplate}}, "normal",
+			Options{Roots: []string{root}, ExecBatch: "ls -d > " + shellQuote(list)})
+	})
+	data, err := os.ReadFile(list)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(data) != filepath.Join(root, "a")+"\n"+filepath.Join(root, "b")+"\n" {
+		t.Errorf("unexpected batch output: %q", data)
+	}
+}
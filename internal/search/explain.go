@@ -0,0 +1,188 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+// Step is a single rule of a template checked by Explain.
+type Step struct {
+	// Nesting level, the rules of a candidate subfolder are one deeper
+	// than the folder rule they belong to
+	Depth  int    `json:"depth"`
+	Passed bool   `json:"passed"`
+	Rule   string `json:"rule"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Explanation is the result of checking a single directory against a
+// template rule by rule.
+type Explanation struct {
+	Path     string `json:"path"`
+	Template string `json:"template"`
+	Matched  bool   `json:"matched"`
+	Score    int    `json:"score"`
+	Steps    []Step `json:"steps"`
+}
+
+// Explain checks the directory dirPath against t like a search would,
+// but evaluates every rule instead of stopping at the first failing one
+// and records what it saw for each of them.
+func Explain(ctx context.Context, dirPath string, t Template) (Explanation, error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return Explanation{}, err
+	}
+	if !info.IsDir() {
+		return Explanation{}, fmt.Errorf("%s is not a directory", dirPath)
+	}
+	if abs, err := filepath.Abs(dirPath); err == nil {
+		dirPath = abs
+	}
+
+	tr := &trace{}
+	matched, score := matchFolder(dirPath, t.Folder, tr)
+	if !newCommandRunner(NewOptions()).run(ctx, t, dirPath, dirPath, tr) {
+		matched = false
+	}
+
+	return Explanation{
+		Path:     filepath.ToSlash(dirPath),
+		Template: t.Name,
+		Matched:  matched,
+		Score:    score,
+		Steps:    tr.steps,
+	}, ctx.Err()
+}
+
+// trace records the rules checked while matching a directory. All
+// methods can be called on a nil trace and do nothing then, so the
+// matching code does not need to know whether it is explaining.
+type trace struct {
+	depth int
+	steps []Step
+}
+
+func (t *trace) add(passed bool, rule, detail string) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, Step{Depth: t.depth, Passed: passed, Rule: rule, Detail: detail})
+}
+
+// child returns a trace for the rules below the next step of t. They are
+// added to t with merge once the result of that step is known.
+func (t *trace) child() *trace {
+	if t == nil {
+		return nil
+	}
+	return &trace{depth: t.depth + 1}
+}
+
+func (t *trace) merge(child *trace) {
+	if t == nil || child == nil {
+		return
+	}
+	t.steps = append(t.steps, child.steps...)
+}
+
+// quote quotes a template value for a trace.
+func quote(s string) string {
+	return "'" + s + "'"
+}
+
+// existence returns the existence of a file or folder rule with the
+// default filled in.
+func existence(e string) string {
+	if e == "" {
+		return "required"
+	}
+	return e
+}
+
+// sizeRange describes a size constraint, e.g. "between 1 KB and 2 MB".
+func sizeRange(s structure.Size) string {
+	min := fmt.Sprintf("%d %s", s.Min, sizeUnit(s.Min_size_type))
+	max := fmt.Sprintf("%d %s", s.Max, sizeUnit(s.Max_size_type))
+
+	switch {
+	case s.Min > 0 && s.Max > 0:
+		return "between " + min + " and " + max
+	case s.Min > 0:
+		return "at least " + min
+	default:
+		return "at most " + max
+	}
+}
+
+func sizeUnit(unit string) string {
+	switch unit {
+	case "KB", "MB", "GB":
+		return unit
+	}
+	return "B"
+}
+
+// formatSize formats a number of bytes with the largest fitting unit,
+// e.g. "1.5 MB".
+func formatSize(n int64) string {
+	units := []string{"KB", "MB", "GB", "TB"}
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	size := float64(n)
+	unit := ""
+	for _, u := range units {
+		if size < 1024 {
+			break
+		}
+		size /= 1024
+		unit = u
+	}
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
+
+// measuredSize is formatSize with the exact number of bytes for a
+// trace, e.g. "2.0 KB (2048 B)".
+func measuredSize(n int64) string {
+	if n < 1024 {
+		return formatSize(n)
+	}
+	return fmt.Sprintf("%s (%d B)", formatSize(n), n)
+}
+
+// ageRange describes an age constraint, e.g. "modified within 30d and
+// before 2025-01-01".
+func ageRange(within, before string) string {
+	switch {
+	case within != "" && before != "":
+		return "modified within " + within + " and before " + before
+	case within != "":
+		return "modified within " + within
+	default:
+		return "modified before " + before
+	}
+}
+
+// formatAge formats a modification time with how long ago it was.
+func formatAge(modified, now time.Time) string {
+	ago := now.Sub(modified)
+	var since string
+	switch {
+	case ago < 0:
+		since = "in the future"
+	case ago < time.Hour:
+		since = fmt.Sprintf("%dm ago", int(ago/time.Minute))
+	case ago < 24*time.Hour:
+		since = fmt.Sprintf("%dh ago", int(ago/time.Hour))
+	default:
+		since = fmt.Sprintf("%dd ago", int(ago/(24*time.Hour)))
+	}
+	return "modified " + modified.Format("2006-01-02 15:04") + ", " + since
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestExplain_RecordsEveryRule(t *testing.T) {
+	proj := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(filepath.Join(proj, "src"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(proj, "a.txt"), []byte("12345"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tpl := Template{Name: "test", Folder: structure.Folder{
+		Name: "other",
+		Files: structure.Files{
+			{Name: "a.txt", DataSize: structure.Size{Min: 10}},
+			{Name: "b.txt", Existence: "forbidden"},
+		},
+		Folders: []structure.Folder{
+			{Name: "src", Files: structure.Files{{Name: "main.go"}}},
+		},
+		DataSize: structure.Size{Max: 1, Max_size_type: "KB"},
+	}}
+
+	exp, err := Explain(context.Background(), proj, tpl)
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	if exp.Matched {
+		t.Fatalf("expected no match")
+	}
+
+	want := []struct {
+		depth  int
+		passed bool
+		rule   string
+		detail string
+	}{
+		{0, false, "name 'other'", "directory is 'proj'"},
+		{0, true, "file 'a.txt' (required)", "found"},
+		{0, false, "size of 'a.txt' at least 10 B", "measured 5 B"},
+		{0, true, "file 'b.txt' (forbidden)", "not found"},
+		{0, false, "folder 'src' (required)", "no matching folder"},
+		{1, false, "candidate 'src'", ""},
+		{2, true, "name 'src'", "directory is 'src'"},
+		{2, false, "file 'main.go' (required)", "not found"},
+		{0, true, "folder size at most 1 KB", "measured 5 B"},
+	}
+
+	if len(exp.Steps) != len(want) {
+		t.Fatalf("expected %d steps, got %+v", len(want), exp.Steps)
+	}
+	for i, w := range want {
+		s := exp.Steps[i]
+		if s.Depth != w.depth || s.Passed != w.passed || s.Rule != w.rule || s.Detail != w.detail {
+			t.Errorf("step %d: expected %+v, got %+v", i, w, s)
+		}
+	}
+}
+
+func TestExplain_Command(t *testing.T) {
+	dir := t.TempDir()
+	tpl := Template{Name: "cmd", Folder: structure.Folder{Command: "echo test"}}
+
+	exp, err := Explain(context.Background(), dir, tpl)
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	if !exp.Matched {
+		t.Fatalf("expected a match, got %+v", exp.Steps)
+	}
+
+	last := exp.Steps[len(exp.Steps)-1]
+	if last.Rule != "command 'echo test'" || !last.Passed || !strings.Contains(last.Detail, "exit status 0") {
+		t.Errorf("unexpected command step: %+v", last)
+	}
+}
+
+func TestExplain_MatchesLikeSearch(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	exp, err := Explain(context.Background(), filepath.Join(root, "a"), Template{Folder: gitTemplate})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	if !exp.Matched {
+		t.Fatalf("expected a match, got %+v", exp.Steps)
+	}
+
+	if _, err := Explain(context.Background(), filepath.Join(root, "missing"), Template{Folder: gitTemplate}); err == nil {
+		t.Fatalf("expected an error for a missing directory")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1536:        "1.5 KB",
+		5 * 1 << 30: "5.0 GB",
+	}
+	for n, want := range cases {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+
+	cases = map[int64]string{
+		1023:        "1023 B",
+		2048:        "2.0 KB (2048 B)",
+		3 * 1 << 20: "3.0 MB (3145728 B)",
+	}
+	for n, want := range cases {
+		if got := measuredSize(n); got != want {
+			t.Errorf("measuredSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestExplain_Age(t *testing.T) {
+	proj := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(proj, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	for _, name := range []string{"old.txt", "new.txt"} {
+		if err := os.WriteFile(filepath.Join(proj, name), nil, 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(proj, "old.txt"), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	tpl := Template{Name: "test", Folder: structure.Folder{
+		Files: structure.Files{
+			{Name: "old.txt", ModifiedBefore: "30d"},
+			{Name: "new.txt", ModifiedWithin: "1d"},
+		},
+		ModifiedBefore: "2025-01-01",
+	}}
+
+	exp, err := Explain(context.Background(), proj, tpl)
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+	if exp.Matched {
+		t.Fatalf("expected no match for the recently modified folder")
+	}
+
+	want := []struct {
+		passed bool
+		rule   string
+	}{
+		{true, "name ''"},
+		{true, "file 'old.txt' (required)"},
+		{true, "'old.txt' modified before 30d"},
+		{true, "file 'new.txt' (required)"},
+		{true, "'new.txt' modified within 1d"},
+		{false, "folder modified before 2025-01-01"},
+	}
+	if len(exp.Steps) != len(want) {
+		t.Fatalf("expected %d steps, got %+v", len(want), exp.Steps)
+	}
+	for i, w := range want {
+		s := exp.Steps[i]
+		if s.Passed != w.passed || s.Rule != w.rule {
+			t.Errorf("step %d: expected %+v, got %+v", i, w, s)
+		}
+	}
+	if detail := exp.Steps[2].Detail; !strings.HasPrefix(detail, "modified "+old.Format("2006-01-02")) || !strings.HasSuffix(detail, ", 60d ago") {
+		t.Errorf("unexpected detail for old.txt: %q", detail)
+	}
+}
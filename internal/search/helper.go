@@ -1,36 +1,61 @@
 package search
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
+	"sort"
+	"time"
 
 	"github.com/shadowdara/finder/internal/structure"
 )
 
-// matchFolderTemplate checks whether the directory at dirPath matches the
+// matchFolder checks whether the directory at dirPath matches the
 // provided template. Matching includes name pattern, required files and
 // required subfolders. Wildcards in template fields are supported via
-// path.Match.
-func matchFolderTemplate(dirPath string, template structure.Folder) bool {
-	// Check folder name if provided
-	dirName := filepath.Base(dirPath)
-
-	if template.Name != "" {
-		ok, err := path.Match(template.Name, dirName)
-		if err != nil || !ok {
-			return false
+// path.Match. Subfolders are matched recursively, so the files, folders
+// and size rules of a nested folder are checked against the real
+// subdirectory contents. It returns the score of the match and records
+// every rule in tr. Without a trace it stops at the first failing rule.
+func matchFolder(dirPath string, template structure.Folder, tr *trace) (matched bool, score int) {
+	nameOK := matchFolderName(dirPath, template)
+	if tr == nil {
+		if !nameOK {
+			return false, 0
 		}
+	} else {
+		tr.add(nameOK, "name "+quote(template.Name), "directory is "+quote(filepath.Base(dirPath)))
 	}
 
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return false
+		tr.add(false, "read directory", err.Error())
+		return false, 0
 	}
 
+	matched, score = matchFolderEntries(dirPath, entries, template, tr)
+	return matched && nameOK, score
+}
+
+// matchFolderName checks the name of the directory at dirPath against
+// the name pattern of the template. An empty pattern matches every name.
+func matchFolderName(dirPath string, template structure.Folder) bool {
+	if template.Name == "" {
+		return true
+	}
+
+	ok, err := path.Match(template.Name, filepath.Base(dirPath))
+	return err == nil && ok
+}
+
+// matchFolderEntries checks the already read entries of dirPath against
+// the files, folders and size rules of the template. The name of the
+// directory itself is not checked here. Every rule is recorded in tr,
+// without a trace the check stops at the first failing rule. score is
+// the sum of the weights of the optional files and folders which exist.
+func matchFolderEntries(dirPath string, entries []fs.DirEntry, template structure.Folder, tr *trace) (matched bool, score int) {
 	// Maps for quick lookups
 	filesMap := map[string]bool{}
 	dirsMap := map[string]bool{}
@@ -43,138 +68,296 @@ func matchFolderTemplate(dirPath string, template structure.Folder) bool {
 		}
 	}
 
-	// Check files with existence logic
-	for _, file := range template.Files {
-		exists := matchAny(filesMap, file.Name)
+	matched = true
 
-		switch file.Existence {
-		case "required", "":
-			if !exists {
-				return false
+	// Check files with existence logic, reading the content last
+	for _, file := range contentLast(template.Files) {
+		ok, weight := matchFile(dirPath, filesMap, file, tr)
+		if !ok {
+			if tr == nil {
+				return false, 0
 			}
+			matched = false
+		}
+		score += weight
+	}
+
+	// Check subfolders (supports wildcards) with the same existence logic
+	for _, folder := range template.Folders {
+		child := tr.child()
+		exists := matchSubfolder(dirPath, dirsMap, folder, child)
+
+		ok := true
+		switch folder.Existence {
+		case "required", "":
+			ok = exists
 		case "forbidden":
-			if exists {
-				return false
-			}
-		case "optional":
-			if !exists {
-				continue
-			}
+			ok = !exists
 		}
 
-		// Größenprüfung nur wenn Datei existiert
-		if exists && (file.DataSize.Min > 0 || file.DataSize.Max > 0) {
-			for name := range filesMap {
-				ok, _ := path.Match(file.Name, name)
-				if ok {
-					info, err := os.Stat(filepath.Join(dirPath, name))
-					if err != nil {
-						return false
-					}
-					if !checkSize(info.Size(), file.DataSize) {
-						return false
-					}
+		if exists && folder.Existence == "optional" {
+			score += weight(folder.Weight)
+		}
+
+		// The rule texts are only built when explaining
+		if tr != nil {
+			detail := "no matching folder"
+			if exists {
+				detail = "a matching folder exists"
+				if folder.Existence == "optional" {
+					detail += fmt.Sprintf(", score +%d", weight(folder.Weight))
 				}
 			}
+			tr.add(ok, "folder "+quote(folder.Name)+" ("+existence(folder.Existence)+")", detail)
+			tr.merge(child)
 		}
-	}
 
-	// Check required subfolders (supports wildcards)
-	for _, folder := range template.Folders {
-		pattern := folder.Name
-		if !matchAny(dirsMap, pattern) {
-			return false
+		if !ok {
+			if tr == nil {
+				return false, 0
+			}
+			matched = false
 		}
 	}
 
 	// Check folder size constraint
 	if template.DataSize.Min > 0 || template.DataSize.Max > 0 {
 		dirSize := getDirSize(dirPath)
-		if !checkSize(dirSize, template.DataSize) {
-			return false
+		ok := checkSize(dirSize, template.DataSize)
+		if tr != nil {
+			tr.add(ok, "folder size "+sizeRange(template.DataSize), "measured "+measuredSize(dirSize))
+		}
+		if !ok {
+			if tr == nil {
+				return false, 0
+			}
+			matched = false
 		}
 	}
 
-	return true
+	// Check the newest modification time below the folder
+	if hasAge(template.ModifiedWithin, template.ModifiedBefore) {
+		now := time.Now()
+		_, _, modified := treeStats(dirPath)
+		ok, err := checkAge(modified, template.ModifiedWithin, template.ModifiedBefore, now)
+		if tr != nil {
+			rule := "folder " + ageRange(template.ModifiedWithin, template.ModifiedBefore)
+			if err != nil {
+				tr.add(false, rule, err.Error())
+			} else {
+				tr.add(ok, rule, "last "+formatAge(modified, now))
+			}
+		}
+		if !ok {
+			if tr == nil {
+				return false, 0
+			}
+			matched = false
+		}
+	}
+
+	// Check the score of the optional files and folders
+	if template.MinScore > 0 {
+		ok := score >= template.MinScore
+		if tr != nil {
+			tr.add(ok, fmt.Sprintf("min score %d", template.MinScore), fmt.Sprintf("score is %d", score))
+		}
+		if !ok {
+			return false, score
+		}
+	}
+
+	return matched, score
 }
 
-// matchAny returns true if at least one entry in the provided map matches
-// the pattern. Exact match is checked first, then path.Match is used for
-// wildcard matching.
-func matchAny(entries map[string]bool, pattern string) bool {
-	if entries[pattern] {
-		return true
+// matchFile checks a single file rule against the names of the files in
+// dirPath. An optional file which exists adds its weight to the score.
+// The rule is only described when explaining.
+func matchFile(dirPath string, files map[string]bool, file structure.File, tr *trace) (matched bool, score int) {
+	var rule string
+	if tr != nil {
+		rule = "file " + quote(file.Name) + " (" + existence(file.Existence) + ")"
+	}
+	exists := matchAny(files, file.Name)
+
+	// A file with other content counts as missing
+	found, missing := "found", "not found"
+	selected := "" // the file with the matching content
+	if hasContentRule(file) {
+		if tr != nil {
+			rule += " " + contentRule(file)
+		}
+		if exists {
+			var checked []string
+			selected, checked = matchContent(dirPath, files, file)
+			exists = selected != ""
+			if tr != nil {
+				found = contentDetail(selected, checked)
+				missing = found
+			}
+		}
 	}
 
-	for name := range entries {
-		ok, _ := path.Match(pattern, name)
-		if ok {
-			return true
+	switch file.Existence {
+	case "required", "":
+		if !exists {
+			tr.add(false, rule, missing)
+			return false, 0
+		}
+	case "forbidden":
+		if exists {
+			tr.add(false, rule, found)
+			return false, 0
+		}
+	case "optional":
+		if exists {
+			score = weight(file.Weight)
 		}
 	}
 
-	return false
-}
+	if !exists {
+		tr.add(true, rule, missing)
+		return true, 0
+	}
+	if tr != nil {
+		detail := found
+		if score != 0 {
+			detail = fmt.Sprintf("%s, score +%d", found, score)
+		}
+		tr.add(true, rule, detail)
+	}
+
+	// Größen- und Altersprüfung nur wenn Datei existiert, mit einer
+	// Inhaltsregel nur für die Datei mit dem passenden Inhalt
+	checkSizes := file.DataSize.Min > 0 || file.DataSize.Max > 0
+	checkAges := hasAge(file.ModifiedWithin, file.ModifiedBefore)
+	if checkSizes || checkAges {
+		matched = true
+		now := time.Now()
+		names := []string{selected}
+		if selected == "" {
+			names = matchingNames(files, file.Name)
+		}
+		for _, name := range names {
+			info, err := os.Stat(filepath.Join(dirPath, name))
+			if err != nil {
+				if tr != nil {
+					tr.add(false, "file "+quote(name), err.Error())
+				}
+				return false, 0
+			}
 
-// executeCommand runs a shell command in dirPath. The function returns
-// true when the command should be considered successful for filtering
-// purposes. An empty command is considered successful. If the command
-// fails but produced output (e.g. some commands write to stderr), this
-// helper treats that as success to allow commands like git status --porcelain
-// to signal repository state.
-func executeCommand(dirPath string, command string, invert_command bool) bool {
-	// Get the wanted return Vale from the Template
-	returnVal := 0
-	if invert_command {
-		returnVal = 1
+			if checkSizes {
+				ok := checkSize(info.Size(), file.DataSize)
+				if tr != nil {
+					tr.add(ok, "size of "+quote(name)+" "+sizeRange(file.DataSize), "measured "+measuredSize(info.Size()))
+				}
+				if !ok {
+					if tr == nil {
+						return false, 0
+					}
+					matched = false
+				}
+			}
+
+			if checkAges {
+				ok, err := checkAge(info.ModTime(), file.ModifiedWithin, file.ModifiedBefore, now)
+				if tr != nil {
+					rule := quote(name) + " " + ageRange(file.ModifiedWithin, file.ModifiedBefore)
+					if err != nil {
+						tr.add(false, rule, err.Error())
+					} else {
+						tr.add(ok, rule, formatAge(info.ModTime(), now))
+					}
+				}
+				if !ok {
+					if tr == nil {
+						return false, 0
+					}
+					matched = false
+				}
+			}
+		}
+		if !matched {
+			return false, 0
+		}
 	}
 
-	if command == "" {
-		return true
+	return true, score
+}
+
+// weight returns the weight of an optional file or folder, 1 when it is
+// not set.
+func weight(w int) int {
+	if w == 0 {
+		return 1
 	}
+	return w
+}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/c", command)
-	} else {
-		cmd = exec.Command("sh", "-c", command)
+// matchSubfolder returns true if at least one subdirectory of dirPath
+// whose name matches the nested template also matches its contents. The
+// checked candidates are recorded in tr.
+func matchSubfolder(dirPath string, dirs map[string]bool, folder structure.Folder, tr *trace) bool {
+	// Exact name first to avoid a full scan in the common case
+	if dirs[folder.Name] && matchCandidate(filepath.Join(dirPath, folder.Name), folder, tr) {
+		return true
 	}
-	cmd.Dir = dirPath
 
-	output, err := cmd.Output()
-	if err != nil {
-		if len(output) > returnVal {
+	for name := range dirs {
+		if name == folder.Name {
+			continue
+		}
+		ok, _ := path.Match(folder.Name, name)
+		if ok && matchCandidate(filepath.Join(dirPath, name), folder, tr) {
 			return true
 		}
-		return false
 	}
 
-	return len(output) > returnVal
+	return false
 }
 
-// findMatchingFolders searches recursively under root and returns a list of
-// directories that match the given template. It uses matchFolderTemplate
-// and executeCommand to filter results.
-func findMatchingFolders(root string, template structure.Folder) []string {
-	var matches []string
+// matchCandidate matches a single subdirectory against a nested folder
+// and records it with its rules in tr.
+func matchCandidate(dirPath string, folder structure.Folder, tr *trace) bool {
+	child := tr.child()
+	ok, _ := matchFolder(dirPath, folder, child)
+	if tr != nil {
+		tr.add(ok, "candidate "+quote(filepath.Base(dirPath)), "")
+		tr.merge(child)
+	}
+	return ok
+}
 
-	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil
-		}
-		if !d.IsDir() {
-			return nil
+// matchingNames returns the sorted names in the map which match the
+// pattern.
+func matchingNames(entries map[string]bool, pattern string) []string {
+	var names []string
+	for name := range entries {
+		if ok, _ := path.Match(pattern, name); ok || name == pattern {
+			names = append(names, name)
 		}
+	}
+	sort.Strings(names)
+	return names
+}
 
-		if matchFolderTemplate(path, template) {
-			if executeCommand(path, template.Command, template.InvertCommand) {
-				matches = append(matches, path)
-			}
+// matchAny returns true if at least one entry in the provided map matches
+// the pattern. Exact match is checked first, then path.Match is used for
+// wildcard matching.
+func matchAny(entries map[string]bool, pattern string) bool {
+	if entries[pattern] {
+		return true
+	}
+
+	for name := range entries {
+		ok, _ := path.Match(pattern, name)
+		if ok {
+			return true
 		}
-		return nil
-	})
+	}
 
-	return matches
+	return false
 }
 
 // convertToBytes converts a value with unit (B, KB, MB, GB) into bytes.
@@ -210,6 +393,37 @@ func checkSize(actual int64, constraint structure.Size) bool {
 	return true
 }
 
+// hasAge reports whether modified_within or modified_before is set.
+func hasAge(within, before string) bool {
+	return within != "" || before != ""
+}
+
+// checkAge validates a modification time against the modified_within
+// and modified_before values of a template at now.
+func checkAge(modified time.Time, within, before string, now time.Time) (bool, error) {
+	if within != "" {
+		t, err := structure.ParseTime(within, now)
+		if err != nil {
+			return false, err
+		}
+		if modified.Before(t) {
+			return false, nil
+		}
+	}
+
+	if before != "" {
+		t, err := structure.ParseTime(before, now)
+		if err != nil {
+			return false, err
+		}
+		if !modified.Before(t) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 // getDirSize calculates total size of directory recursively.
 func getDirSize(dir string) int64 {
 	var total int64
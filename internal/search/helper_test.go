@@ -1,13 +1,38 @@
 package search
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/shadowdara/finder/internal/structure"
 )
 
+// matchFolderTemplate reports whether dirPath matches template.
+func matchFolderTemplate(dirPath string, template structure.Folder) bool {
+	matched, _ := matchFolder(dirPath, template, nil)
+	return matched
+}
+
+// executeCommand runs command in dirPath like a template command without
+// a command_mode.
+func executeCommand(ctx context.Context, dirPath string, command string, invert_command bool) bool {
+	t := Template{Folder: structure.Folder{
+		Command:       command,
+		InvertCommand: invert_command,
+	}}
+	return newCommandRunner(NewOptions()).run(ctx, t, dirPath, dirPath, nil)
+}
+
+// findMatchingFolders walks root with a single template and returns the
+// sorted paths of the matches.
+func findMatchingFolders(ctx context.Context, root string, template structure.Folder, opts Options) []string {
+	w := newWalker([]Template{{Folder: template}}, opts)
+	return resultPaths(w.run(ctx, []string{root}))
+}
+
 func TestMatchFolderTemplateAndFind(t *testing.T) {
 	root := t.TempDir()
 
@@ -32,8 +57,227 @@ func TestMatchFolderTemplateAndFind(t *testing.T) {
 		t.Fatalf("expected matchFolderTemplate to match")
 	}
 
-	matches := findMatchingFolders(root, tpl)
+	matches := findMatchingFolders(context.Background(), root, tpl, Options{})
 	if len(matches) == 0 {
 		t.Fatalf("expected findMatchingFolders to find at least one match")
 	}
 }
+
+func TestMatchFolderTemplate_NestedFiles(t *testing.T) {
+	root := t.TempDir()
+	proj := filepath.Join(root, "proj")
+	if err := os.MkdirAll(filepath.Join(proj, "src", "components"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	tpl := structure.Folder{
+		Name: "*",
+		Folders: []structure.Folder{
+			{
+				Name: "src",
+				Folders: []structure.Folder{
+					{Name: "components", Files: structure.Files{{Name: "*.tsx"}}},
+				},
+			},
+		},
+	}
+
+	if matchFolderTemplate(proj, tpl) {
+		t.Fatalf("expected no match without a .tsx file in src/components")
+	}
+
+	if err := os.WriteFile(filepath.Join(proj, "src", "components", "App.tsx"), []byte("x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if !matchFolderTemplate(proj, tpl) {
+		t.Fatalf("expected match with a .tsx file in src/components")
+	}
+}
+
+func TestMatchFolderTemplate_NestedWildcardChecksEveryCandidate(t *testing.T) {
+	root := t.TempDir()
+	proj := filepath.Join(root, "proj")
+	for _, dir := range []string{"packages/a", "packages/b"} {
+		if err := os.MkdirAll(filepath.Join(proj, dir), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(proj, "packages", "b", "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tpl := structure.Folder{
+		Folders: []structure.Folder{
+			{
+				Name: "packages",
+				Folders: []structure.Folder{
+					{Name: "*", Files: structure.Files{{Name: "package.json"}}},
+				},
+			},
+		},
+	}
+
+	if !matchFolderTemplate(proj, tpl) {
+		t.Fatalf("expected match when one of the wildcard subfolders matches")
+	}
+}
+
+func TestMatchFolderTemplate_NestedForbiddenFolder(t *testing.T) {
+	root := t.TempDir()
+	proj := filepath.Join(root, "proj")
+	if err := os.MkdirAll(filepath.Join(proj, "build"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	tpl := structure.Folder{
+		Folders: []structure.Folder{
+			{Name: "build", Existence: "forbidden"},
+		},
+	}
+
+	if matchFolderTemplate(proj, tpl) {
+		t.Fatalf("expected no match with a forbidden subfolder")
+	}
+
+	if err := os.Remove(filepath.Join(proj, "build")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if !matchFolderTemplate(proj, tpl) {
+		t.Fatalf("expected match without the forbidden subfolder")
+	}
+}
+
+func TestFindMatchingFolders_DepthLimits(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/.git", "a/b/.git", "a/b/c/.git"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+
+	tpl := structure.Folder{
+		Name:    "*",
+		Folders: []structure.Folder{{Name: ".git"}},
+	}
+
+	if matches := findMatchingFolders(context.Background(), root, tpl, Options{}); len(matches) != 3 {
+		t.Fatalf("expected 3 matches without limits, got %v", matches)
+	}
+
+	matches := findMatchingFolders(context.Background(), root, tpl, Options{MaxDepth: 2})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches with max depth 2, got %v", matches)
+	}
+
+	matches = findMatchingFolders(context.Background(), root, tpl, Options{MinDepth: 2})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches with min depth 2, got %v", matches)
+	}
+
+	// The template value is used when the option is not set
+	tpl.MaxDepth = 1
+	if matches := findMatchingFolders(context.Background(), root, tpl, Options{}); len(matches) != 1 {
+		t.Fatalf("expected 1 match with template max_depth 1, got %v", matches)
+	}
+	if matches := findMatchingFolders(context.Background(), root, tpl, Options{MaxDepth: 3}); len(matches) != 3 {
+		t.Fatalf("expected option to override template max_depth, got %v", matches)
+	}
+}
+
+func TestMatchFolder_Score(t *testing.T) {
+	proj := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(filepath.Join(proj, "docs"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"go.mod", "README.md"} {
+		if err := os.WriteFile(filepath.Join(proj, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	tpl := structure.Folder{
+		Files: structure.Files{
+			{Name: "go.mod"},
+			{Name: "README.md", Existence: "optional", Weight: 3},
+			{Name: "LICENSE", Existence: "optional", Weight: 5},
+		},
+		Folders: []structure.Folder{
+			{Name: "docs", Existence: "optional"},
+		},
+	}
+
+	matched, score := matchFolder(proj, tpl, nil)
+	if !matched || score != 4 {
+		t.Fatalf("expected a match with score 4, got %v with score %d", matched, score)
+	}
+
+	tpl.MinScore = 5
+	if matched, _ := matchFolder(proj, tpl, nil); matched {
+		t.Fatalf("expected no match below the min score")
+	}
+
+	if err := os.WriteFile(filepath.Join(proj, "LICENSE"), []byte("x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	matched, score = matchFolder(proj, tpl, nil)
+	if !matched || score != 9 {
+		t.Fatalf("expected a match with score 9, got %v with score %d", matched, score)
+	}
+}
+
+func TestFindMatchingFolders_Age(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-90 * 24 * time.Hour)
+	for _, name := range []string{"stale", "fresh"} {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), nil, 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for _, p := range []string{"stale/go.mod", "stale"} {
+		if err := os.Chtimes(filepath.Join(root, p), old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	tpl := structure.Folder{Name: "*", Files: structure.Files{{Name: "go.mod"}}}
+	ctx := context.Background()
+
+	stale := tpl
+	stale.ModifiedBefore = "30d"
+	if got := findMatchingFolders(ctx, root, stale, Options{}); len(got) != 1 || filepath.Base(got[0]) != "stale" {
+		t.Errorf("expected only the stale folder, got %v", got)
+	}
+
+	// The options override the template
+	if got := findMatchingFolders(ctx, root, stale, Options{ModifiedBefore: "2000-01-01", ModifiedWithin: "1w"}); len(got) != 0 {
+		t.Errorf("expected no folder for the options, got %v", got)
+	}
+	if got := findMatchingFolders(ctx, root, tpl, Options{ModifiedWithin: "1w"}); len(got) != 1 || filepath.Base(got[0]) != "fresh" {
+		t.Errorf("expected only the fresh folder, got %v", got)
+	}
+}
+
+func TestMatchFile_NoTraceDoesNotAllocate(t *testing.T) {
+	files := map[string]bool{"go.mod": true, "README.md": true}
+	rules := structure.Files{
+		{Name: "go.mod"},
+		{Name: "README.md", Existence: "optional", Weight: 2},
+		{Name: "LICENSE", Existence: "forbidden"},
+	}
+
+	dir := t.TempDir()
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, file := range rules {
+			matchFile(dir, files, file, nil)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations without a trace, got %v", allocs)
+	}
+}
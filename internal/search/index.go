@@ -0,0 +1,370 @@
+package search
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// indexVersion is increased when the format of the index file changes.
+const indexVersion = 1
+
+// IndexFileName is the name of the index file in the finder config dir.
+const IndexFileName = "index.gob"
+
+// ErrNoIndex is returned by LoadIndex when no index was built yet.
+var ErrNoIndex = errors.New("no index found, run 'finder index build' first")
+
+// DefaultIndexPath returns the path of the index: $FINDER_INDEX or
+// ~/.finder/index.gob.
+func DefaultIndexPath() (string, error) {
+	if env := os.Getenv("FINDER_INDEX"); env != "" {
+		return env, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".finder", IndexFileName), nil
+}
+
+// Index stores the directory listings below its roots, so a search can
+// use them instead of reading every directory again. A listing is only
+// read again when the modification time of its directory changed.
+//
+// The fields are exported for encoding/gob, use the methods to work with
+// an index.
+type Index struct {
+	Version int
+	Roots   []string
+	Updated time.Time
+	Dirs    map[string]IndexDir
+
+	path    string
+	mu      sync.Mutex
+	changed bool
+}
+
+// IndexDir is the listing of a single directory.
+type IndexDir struct {
+	ModTime int64 // UnixNano of the directory when it was read
+	Entries []IndexEntry
+}
+
+// IndexEntry is a file or directory of an IndexDir.
+type IndexEntry struct {
+	Name    string
+	Mode    fs.FileMode
+	Size    int64
+	ModTime int64 // UnixNano
+}
+
+// IndexStats counts what a refresh of an index did.
+type IndexStats struct {
+	Dirs    int // directories below the roots
+	Read    int // directories which were new or changed and read again
+	Removed int // directories which do not exist anymore
+}
+
+// NewIndex returns an empty index of roots which is saved at path.
+func NewIndex(path string, roots []string) *Index {
+	return &Index{
+		Version: indexVersion,
+		Roots:   normalizeRoots(roots),
+		Dirs:    map[string]IndexDir{},
+		path:    path,
+	}
+}
+
+// LoadIndex reads the index saved at path. ErrNoIndex is returned when
+// the file does not exist.
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoIndex
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %s: %v", path, err)
+	}
+
+	ix := &Index{}
+	if err := gob.NewDecoder(zr).Decode(ix); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %v", path, err)
+	}
+	if ix.Version != indexVersion {
+		return nil, fmt.Errorf("the index %s was built by another version of finder, run 'finder index build'", path)
+	}
+	if ix.Dirs == nil {
+		ix.Dirs = map[string]IndexDir{}
+	}
+	ix.path = path
+
+	return ix, nil
+}
+
+// Path returns the file the index is saved to.
+func (ix *Index) Path() string {
+	return ix.path
+}
+
+// Save writes the index to its file. The file is replaced at once, so
+// a search running at the same time never reads half an index.
+func (ix *Index) Save() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ix.path), IndexFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	zw := gzip.NewWriter(tmp)
+	err = gob.NewEncoder(zw).Encode(ix)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), ix.path); err != nil {
+		return err
+	}
+	ix.changed = false
+	return nil
+}
+
+// Entries returns the number of files and directories in the index.
+func (ix *Index) Entries() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	n := 0
+	for _, d := range ix.Dirs {
+		n += len(d.Entries)
+	}
+	return n
+}
+
+// Stale returns the number of indexed directories which were changed or
+// removed since they were read.
+func (ix *Index) Stale() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	n := 0
+	for path, d := range ix.Dirs {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().UnixNano() != d.ModTime {
+			n++
+		}
+	}
+	return n
+}
+
+// Refresh walks the roots of the index and reads the directories which
+// are new or whose modification time changed. Directories which do not
+// exist anymore or are excluded now are removed. The excludes and jobs
+// of opts are used like for a search. When ctx is done the walk stops
+// and nothing is removed.
+func (ix *Index) Refresh(ctx context.Context, opts Options) (IndexStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stats IndexStats
+	var mu sync.Mutex
+	seen := map[string]bool{}
+
+	queue := newJobQueue(ctx)
+	for _, root := range ix.Roots {
+		queue.push(walkJob{path: root, exclude: newExcluder(root, nil, opts)})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.jobs(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := queue.pop()
+				if !ok {
+					return
+				}
+
+				entries, read, err := ix.readDir(job.path)
+				if err == nil {
+					mu.Lock()
+					seen[job.path] = true
+					stats.Dirs++
+					if read {
+						stats.Read++
+					}
+					mu.Unlock()
+
+					ignore := ignoreRules(job.path, entries, job.ignore)
+					for _, e := range entries {
+						child := filepath.Join(job.path, e.Name())
+						if e.IsDir() && !job.exclude.excluded(child, ignore) {
+							queue.push(walkJob{path: child, exclude: job.exclude, ignore: ignore})
+						}
+					}
+				}
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	ix.mu.Lock()
+	for path := range ix.Dirs {
+		if !seen[path] {
+			delete(ix.Dirs, path)
+			stats.Removed++
+		}
+	}
+	ix.Updated = time.Now()
+	ix.changed = true
+	ix.mu.Unlock()
+
+	return stats, nil
+}
+
+// readDir returns the entries of dirPath from the index. A directory
+// which is new or changed since it was indexed is read from the disk
+// and stored when it lies below a root of the index. read reports
+// whether the disk was read.
+func (ix *Index) readDir(dirPath string) (entries []fs.DirEntry, read bool, err error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		ix.mu.Lock()
+		if _, ok := ix.Dirs[dirPath]; ok {
+			delete(ix.Dirs, dirPath)
+			ix.changed = true
+		}
+		ix.mu.Unlock()
+		return nil, false, err
+	}
+
+	ix.mu.Lock()
+	d, ok := ix.Dirs[dirPath]
+	ix.mu.Unlock()
+	if ok && d.ModTime == info.ModTime().UnixNano() {
+		return d.dirEntries(), false, nil
+	}
+
+	d, err = readIndexDir(dirPath, info)
+	if err != nil {
+		return nil, true, err
+	}
+	if ix.covers(dirPath) {
+		ix.mu.Lock()
+		ix.Dirs[dirPath] = d
+		ix.changed = true
+		ix.mu.Unlock()
+	}
+
+	return d.dirEntries(), true, nil
+}
+
+// covers reports whether dirPath lies below a root of the index.
+func (ix *Index) covers(dirPath string) bool {
+	for _, root := range ix.Roots {
+		if isWithin(root, dirPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveChanges saves the index when a search read directories again. An
+// error is only reported, the search itself did not fail.
+func (ix *Index) saveChanges() {
+	ix.mu.Lock()
+	changed := ix.changed
+	ix.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if err := ix.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] could not update the index: %v\n", err)
+	}
+}
+
+// readIndexDir reads the listing of dirPath, info is the directory
+// itself.
+func readIndexDir(dirPath string, info fs.FileInfo) (IndexDir, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return IndexDir{}, err
+	}
+
+	d := IndexDir{
+		ModTime: info.ModTime().UnixNano(),
+		Entries: make([]IndexEntry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		entry := IndexEntry{Name: e.Name(), Mode: e.Type()}
+		if info, err := e.Info(); err == nil {
+			entry.Mode = info.Mode()
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime().UnixNano()
+		}
+		d.Entries = append(d.Entries, entry)
+	}
+
+	return d, nil
+}
+
+// dirEntries returns the entries like os.ReadDir.
+func (d IndexDir) dirEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(d.Entries))
+	for i, e := range d.Entries {
+		entries[i] = indexDirEntry{e}
+	}
+	return entries
+}
+
+// indexDirEntry is an IndexEntry as fs.DirEntry and fs.FileInfo.
+type indexDirEntry struct {
+	e IndexEntry
+}
+
+func (e indexDirEntry) Name() string               { return e.e.Name }
+func (e indexDirEntry) IsDir() bool                { return e.e.Mode.IsDir() }
+func (e indexDirEntry) Type() fs.FileMode          { return e.e.Mode.Type() }
+func (e indexDirEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e indexDirEntry) Size() int64                { return e.e.Size }
+func (e indexDirEntry) Mode() fs.FileMode          { return e.e.Mode }
+func (e indexDirEntry) ModTime() time.Time         { return time.Unix(0, e.e.ModTime) }
+func (e indexDirEntry) Sys() interface{}           { return nil }
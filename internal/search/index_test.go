@@ -0,0 +1,142 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// resetModTime sets the modification time of dir back to before, so a
+// change inside it is not noticed by the index.
+func resetModTime(t *testing.T, dir string, before time.Time) {
+	t.Helper()
+	if err := os.Chtimes(dir, before, before); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestIndex_BuildSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b/c")
+	if err := os.WriteFile(filepath.Join(root, "a", "go.mod"), []byte("module a"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index", IndexFileName)
+	if _, err := LoadIndex(path); !errors.Is(err, ErrNoIndex) {
+		t.Fatalf("expected ErrNoIndex before the build, got %v", err)
+	}
+
+	ix := NewIndex(path, []string{root})
+	stats, err := ix.Refresh(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// root, a, a/.git, b, b/c, b/c/.git
+	if stats.Dirs != 6 || stats.Read != 6 {
+		t.Errorf("expected 6 directories read, got %+v", stats)
+	}
+	if err := ix.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Roots, []string{root}) || len(loaded.Dirs) != 6 {
+		t.Fatalf("expected the saved index, got roots %v with %d directories", loaded.Roots, len(loaded.Dirs))
+	}
+
+	entries, read, err := loaded.readDir(filepath.Join(root, "a"))
+	if err != nil || read {
+		t.Fatalf("expected the listing from the index, got read=%v err=%v", read, err)
+	}
+	for _, e := range entries {
+		if e.Name() != "go.mod" {
+			continue
+		}
+		info, _ := e.Info()
+		if e.IsDir() || info.Size() != 8 {
+			t.Errorf("expected the file go.mod with 8 bytes, got dir=%v size=%d", e.IsDir(), info.Size())
+		}
+	}
+	if loaded.Stale() != 0 {
+		t.Errorf("expected an up to date index, %d directories are stale", loaded.Stale())
+	}
+}
+
+func TestIndex_RefreshReadsOnlyChangedDirectories(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+
+	ix := NewIndex(filepath.Join(t.TempDir(), IndexFileName), []string{root})
+	if _, err := ix.Refresh(context.Background(), Options{}); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// A new directory changes the modification time of its parent
+	makeGitRepos(t, root, "a/new")
+	if err := os.RemoveAll(filepath.Join(root, "b")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if ix.Stale() != 4 {
+		t.Errorf("expected root, a, b and b/.git to be stale, got %d", ix.Stale())
+	}
+
+	stats, err := ix.Refresh(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// root and a changed, a/new and a/new/.git are new
+	want := IndexStats{Dirs: 5, Read: 4, Removed: 2}
+	if stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestFind_UsesIndex(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+	if err := os.Mkdir(filepath.Join(root, "b"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	ix := NewIndex(filepath.Join(t.TempDir(), IndexFileName), []string{root})
+	if _, err := ix.Refresh(context.Background(), Options{}); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// Hide a new repository from the index by keeping the old mtime of b
+	info, err := os.Stat(filepath.Join(root, "b"))
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	makeGitRepos(t, root, "b")
+	resetModTime(t, filepath.Join(root, "b"), info.ModTime())
+
+	// A changed directory is read again
+	makeGitRepos(t, root, "c")
+
+	got := findMatchingFolders(context.Background(), root, gitTemplate, Options{Index: ix})
+	want := []string{filepath.Join(root, "a"), filepath.Join(root, "c")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the matches from the index %v, got %v", want, got)
+	}
+
+	if _, err := LoadIndex(ix.Path()); err != nil {
+		t.Errorf("expected the search to save the updated index, got %v", err)
+	}
+	if _, ok := ix.Dirs[filepath.Join(root, "c")]; !ok {
+		t.Errorf("expected the new directory to be added to the index")
+	}
+
+	all := findMatchingFolders(context.Background(), root, gitTemplate, Options{})
+	if len(all) != 3 {
+		t.Errorf("expected 3 matches without the index, got %v", all)
+	}
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns are the result fields which can be selected with
+// Options.Columns.
+var Columns = []string{"path", "template", "size", "files", "mtime", "branch", "score", "parent"}
+
+// IsColumn reports whether name is a supported column.
+func IsColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasColumn reports whether name is one of columns.
+func hasColumn(columns []string, name string) bool {
+	for _, c := range columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addMetadata fills the fields of result which are needed for columns.
+// The size, file count and modification time need a walk of the whole
+// directory, so they are only collected when one of them is selected.
+func addMetadata(result *Result, columns []string) {
+	if hasColumn(columns, "size") || hasColumn(columns, "files") || hasColumn(columns, "mtime") {
+		size, files, modified := treeStats(result.Path)
+		result.Size = size
+		result.FileCount = files
+		result.Modified = &modified
+	}
+	if hasColumn(columns, "branch") {
+		result.Branch = gitBranch(result.Path)
+	}
+}
+
+// treeStats returns the total size and number of the files below dir and
+// the newest modification time of dir and everything below it.
+func treeStats(dir string) (size int64, files int, modified time.Time) {
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		if !d.IsDir() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+
+	return size, files, modified
+}
+
+// gitBranch returns the checked out branch of the git repository in dir,
+// the short commit hash for a detached HEAD and "" when dir is no git
+// repository. A .git file as used by worktrees and submodules is
+// followed.
+func gitBranch(dir string) string {
+	gitDir := filepath.Join(dir, ".git")
+
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return ""
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(gitDir)
+		if err != nil {
+			return ""
+		}
+		link := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(dir, link)
+		}
+		gitDir = link
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+
+	head := strings.TrimSpace(string(data))
+	if strings.HasPrefix(head, "ref:") {
+		ref := strings.TrimSpace(strings.TrimPrefix(head, "ref:"))
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 7 {
+		return head[:7]
+	}
+	return head
+}
+
+// column returns the value of a column of the result for the output.
+func (r Result) column(name string) string {
+	switch name {
+	case "path":
+		return r.Path
+	case "template":
+		return strings.Join(r.Templates, ",")
+	case "size":
+		return formatSize(r.Size)
+	case "files":
+		return strconv.Itoa(r.FileCount)
+	case "mtime":
+		if r.Modified == nil {
+			return ""
+		}
+		return r.Modified.Format("2006-01-02 15:04")
+	case "branch":
+		return r.Branch
+	case "score":
+		return strconv.Itoa(r.Score)
+	case "parent":
+		return r.Parent
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTreeStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, size := range map[string]int{"a": 10, "sub/b": 20} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	newest := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(dir, "sub", "b"), newest, newest); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	size, files, modified := treeStats(dir)
+	if size != 30 || files != 2 {
+		t.Errorf("expected 30 bytes in 2 files, got %d bytes in %d files", size, files)
+	}
+	if !modified.Equal(newest) {
+		t.Errorf("expected the newest modification %v, got %v", newest, modified)
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	root := t.TempDir()
+	write(filepath.Join(root, "branch", ".git", "HEAD"), "ref: refs/heads/feature/x\n")
+	write(filepath.Join(root, "detached", ".git", "HEAD"), "0123456789abcdef\n")
+	write(filepath.Join(root, "main", ".git", "worktrees", "wt", "HEAD"), "ref: refs/heads/wt-branch\n")
+	write(filepath.Join(root, "wt", ".git"), "gitdir: ../main/.git/worktrees/wt\n")
+	if err := os.Mkdir(filepath.Join(root, "none"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	cases := map[string]string{
+		"branch":   "feature/x",
+		"detached": "0123456",
+		"wt":       "wt-branch",
+		"none":     "",
+	}
+	for dir, want := range cases {
+		if got := gitBranch(filepath.Join(root, dir)); got != want {
+			t.Errorf("gitBranch(%s) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestFind_ClearColumns(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+	if err := os.WriteFile(filepath.Join(root, "a", ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	output := captureSearchOutput(func() {
+		FindAll(context.Background(), []Template{{Name: "git", Folder: gitTemplate}}, "clear",
+			Options{Roots: []string{root}, Columns: []string{"template", "branch", "files", "path"}})
+	})
+
+	want := "git\tmain\t1\t" + filepath.ToSlash(filepath.Join(root, "a"))
+	if strings.TrimSpace(output) != want {
+		t.Errorf("expected %q, got %q", want, output)
+	}
+}
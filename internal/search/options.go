@@ -0,0 +1,179 @@
+package search
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+// Options controls where and how Find searches.
+type Options struct {
+	// Directories to search. When empty the whole filesystem (all drives
+	// on Windows) is searched.
+	Roots []string
+
+	// Depth limits relative to a root, which has depth 0. A MaxDepth of 0
+	// uses the max_depth of the template or is unlimited.
+	MaxDepth int
+	MinDepth int
+
+	// Gitignore style patterns for directories which are not searched
+	Excludes []string
+	// Also search the directories from defaultExcludes
+	NoDefaultExcludes bool
+
+	// Number of directories read at the same time, 0 uses GOMAXPROCS
+	Jobs int
+
+	// Directory listings to use instead of reading every directory, see
+	// Index. Changed directories are read again and saved to the index.
+	Index *Index
+
+	// Stop the search after this time, 0 means no timeout
+	Timeout time.Duration
+
+	// Kill a template command after this time, 0 means no timeout. A
+	// command which timed out does not match.
+	CommandTimeout time.Duration
+	// Number of template commands running at the same time, 0 uses
+	// GOMAXPROCS
+	CommandJobs int
+
+	// Only report matches whose newest file was modified after or
+	// before this age or date, overrides modified_within and
+	// modified_before of the templates, see structure.ParseTime
+	ModifiedWithin string
+	ModifiedBefore string
+
+	// Do not search below a match, can also be set by the template
+	PruneMatches bool
+	// Report the nearest enclosing match of every match as its parent
+	Nested bool
+	// Print the results grouped by template
+	Group bool
+	// Result fields to print, see Columns
+	Columns []string
+	// Order of the results, see SortKeys. When set, the results are
+	// printed after the search instead of while searching.
+	Sort    string
+	Reverse bool
+
+	// Command to run in every found directory instead of printing it,
+	// see expandPlaceholders
+	Exec string
+	// Command to run once with all found directories
+	ExecBatch string
+	// Number of Exec commands running at the same time, 0 uses GOMAXPROCS
+	ExecJobs int
+}
+
+// DefaultCommandTimeout is the CommandTimeout of NewOptions.
+const DefaultCommandTimeout = 30 * time.Second
+
+// NewOptions returns the default options which search the current
+// directory.
+func NewOptions() Options {
+	return Options{
+		Roots:          []string{"."},
+		CommandTimeout: DefaultCommandTimeout,
+	}
+}
+
+// Executes reports whether the found directories are passed to a
+// command instead of being printed.
+func (opts Options) Executes() bool {
+	return opts.Exec != "" || opts.ExecBatch != ""
+}
+
+// metadata returns the result fields which have to be collected for the
+// columns and the sort key.
+func (opts Options) metadata() []string {
+	fields := opts.Columns
+	if opts.Sort == "size" || opts.Sort == "mtime" {
+		fields = append(append([]string{}, fields...), opts.Sort)
+	}
+	return fields
+}
+
+// maxDepth returns the max depth for a search with template. The option
+// overrides the value from the template.
+func (opts Options) maxDepth(template structure.Folder) int {
+	if opts.MaxDepth > 0 {
+		return opts.MaxDepth
+	}
+	return template.MaxDepth
+}
+
+// template returns t with the age filters of the options applied.
+func (opts Options) template(t Template) Template {
+	if opts.ModifiedWithin != "" {
+		t.Folder.ModifiedWithin = opts.ModifiedWithin
+	}
+	if opts.ModifiedBefore != "" {
+		t.Folder.ModifiedBefore = opts.ModifiedBefore
+	}
+	return t
+}
+
+// searchRoots returns the absolute, deduplicated roots for opts. Roots
+// that lie inside another root are dropped so that no directory is
+// walked twice.
+func (opts Options) searchRoots() []string {
+	if len(opts.Roots) == 0 {
+		return getSearchRoots()
+	}
+	return normalizeRoots(opts.Roots)
+}
+
+// normalizeRoots makes every root absolute and removes duplicates and
+// roots nested below another root. The result is sorted.
+func normalizeRoots(roots []string) []string {
+	var cleaned []string
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			abs = filepath.Clean(root)
+		}
+		cleaned = append(cleaned, abs)
+	}
+
+	// Parents sort before their children
+	sort.Strings(cleaned)
+
+	var result []string
+	for _, root := range cleaned {
+		nested := false
+		for _, parent := range result {
+			if isWithin(parent, root) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			result = append(result, root)
+		}
+	}
+
+	return result
+}
+
+// isWithin reports whether path is parent itself or lies below parent.
+func isWithin(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// depthBelow returns how many directories path lies below root.
+func depthBelow(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
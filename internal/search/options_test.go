@@ -0,0 +1,53 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeRoots_RemovesNestedAndDuplicateRoots(t *testing.T) {
+	base := t.TempDir()
+	home := filepath.Join(base, "home")
+
+	roots := normalizeRoots([]string{
+		filepath.Join(home, "me"),
+		home,
+		home + string(filepath.Separator),
+		filepath.Join(base, "home-other"),
+	})
+
+	if len(roots) != 2 {
+		t.Fatalf("expected 2 roots, got %v", roots)
+	}
+	if roots[0] != home {
+		t.Errorf("expected first root %q, got %q", home, roots[0])
+	}
+	if roots[1] != filepath.Join(base, "home-other") {
+		t.Errorf("expected sibling root to be kept, got %q", roots[1])
+	}
+}
+
+func TestNormalizeRoots_MakesRootsAbsolute(t *testing.T) {
+	roots := normalizeRoots([]string{"."})
+
+	if len(roots) != 1 || !filepath.IsAbs(roots[0]) {
+		t.Fatalf("expected one absolute root, got %v", roots)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	parent := filepath.Join("/", "home")
+
+	if !isWithin(parent, filepath.Join(parent, "me")) {
+		t.Errorf("expected child to be within parent")
+	}
+	if !isWithin(parent, parent) {
+		t.Errorf("expected parent to be within itself")
+	}
+	if isWithin(parent, filepath.Join("/", "home-other")) {
+		t.Errorf("expected sibling with common prefix not to be within parent")
+	}
+	if isWithin(parent, "/") {
+		t.Errorf("expected ancestor not to be within parent")
+	}
+}
@@ -0,0 +1,304 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+	"github.com/shadowdara/finder/pub/goansi"
+)
+
+// OutputTypes are the supported values for the output type of Find.
+var OutputTypes = []string{"normal", "json", "ndjson", "clear"}
+
+// IsOutputType reports whether name is a supported output type.
+func IsOutputType(name string) bool {
+	for _, t := range OutputTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// printer writes the results of a search. Except for "json", which
+// needs the complete list, every match is written the moment it is
+// found so the output can be piped while the search is still running.
+// Grouped, sorted, ranked and table output is also written at the end.
+type printer struct {
+	outputType string
+	templates  []string // names of the searched templates
+	nested     bool     // print the parent of every result
+	labels     bool     // print the templates of every result
+	group      bool     // group the results by template
+	scores     bool     // a template is scored, print the best results first with their score
+	columns    []string // result fields to print instead of the path
+	sorted     bool     // print all results in order after the search
+	out        io.Writer
+	enc        *json.Encoder
+
+	mu    sync.Mutex
+	count int
+}
+
+func newPrinter(outputType string, opts Options, templates []Template) *printer {
+	names := make([]string, len(templates))
+	scores := false
+	for i, t := range templates {
+		names[i] = t.Name
+		scores = scores || scored(t.Folder)
+	}
+
+	return &printer{
+		outputType: outputType,
+		templates:  names,
+		nested:     opts.Nested && !opts.PruneMatches,
+		labels:     len(templates) > 1,
+		group:      opts.Group,
+		scores:     scores,
+		columns:    opts.Columns,
+		sorted:     opts.Sort != "" || opts.Reverse,
+		out:        os.Stdout,
+		enc:        json.NewEncoder(os.Stdout),
+	}
+}
+
+// header is written before the search starts.
+func (p *printer) header() {
+	if p.outputType == "normal" {
+		fmt.Fprintln(p.out, "# Found:")
+	}
+}
+
+// match writes a single match. It is safe to call from several workers.
+func (p *printer) match(result Result) {
+	result = slashResult(result)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.count++
+
+	if p.deferred() {
+		// Written by footer
+		return
+	}
+
+	switch p.outputType {
+	case "normal", "clear":
+		p.line(result)
+	case "ndjson":
+		if err := p.enc.Encode(result); err != nil {
+			fmt.Fprintln(os.Stderr, "JSON encoding error:", err)
+		}
+	}
+}
+
+// deferred reports whether the matches are written by footer in order
+// instead of while searching.
+func (p *printer) deferred() bool {
+	switch p.outputType {
+	case "normal":
+		return p.group || p.scores || p.sorted || len(p.columns) > 0
+	case "clear":
+		// Grouping has no format here, every line carries its templates
+		return p.scores || p.sorted
+	case "ndjson":
+		return p.scores || p.sorted
+	}
+	return false
+}
+
+// line writes a result in the "normal" or "clear" format.
+func (p *printer) line(result Result) {
+	if p.outputType == "clear" && len(p.columns) > 0 {
+		values := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			values[i] = result.column(c)
+		}
+		fmt.Fprintln(p.out, strings.Join(values, "\t"))
+		return
+	}
+
+	if p.outputType == "clear" {
+		// Tab separated columns: path, templates, parent
+		columns := []string{result.Path}
+		if p.labels {
+			columns = append(columns, strings.Join(result.Templates, ","))
+		}
+		if p.nested {
+			columns = append(columns, result.Parent)
+		}
+		fmt.Fprintln(p.out, strings.Join(columns, "\t"))
+		return
+	}
+
+	line := result.Path
+	if p.labels {
+		line += "  [" + strings.Join(result.Templates, ", ") + "]"
+	}
+	if result.Parent != "" {
+		line += "  (inside " + result.Parent + ")"
+	}
+	if p.scores {
+		line += fmt.Sprintf("  (score %d)", result.Score)
+	}
+	fmt.Fprintln(p.out, line)
+}
+
+// slashResult normalizes Windows backslashes to forward slashes for
+// consistent output.
+func slashResult(result Result) Result {
+	result.Path = filepath.ToSlash(result.Path)
+	if result.Parent != "" {
+		result.Parent = filepath.ToSlash(result.Parent)
+	}
+	return result
+}
+
+// footer is written after the search with all matches sorted by score
+// and path.
+// A non-nil err means the search was stopped early and matches are only
+// the results found so far.
+func (p *printer) footer(matches []Result, elapsed time.Duration, err error) {
+	if err != nil && p.outputType != "normal" {
+		// Keep stdout parseable for the other output types
+		fmt.Fprintf(os.Stderr, "%s[WARNING] %s, the results are incomplete%s\n",
+			goansi.YELLOW, interruptReason(err), goansi.END)
+	}
+
+	switch p.outputType {
+	case "normal":
+		if p.group {
+			p.groups(matches)
+		} else if len(p.columns) > 0 {
+			p.table(matches)
+		} else if p.deferred() {
+			for _, m := range matches {
+				p.line(slashResult(m))
+			}
+		}
+		fmt.Fprintln(p.out, "# End of the List")
+		if err != nil {
+			fmt.Fprintf(p.out, "%s# %s, the results are incomplete%s\n",
+				goansi.YELLOW, interruptReason(err), goansi.END)
+		}
+		fmt.Fprintf(p.out, "Search by finder took: %.4f seconds\n", elapsed.Seconds())
+		fmt.Fprintf(p.out, "Found: %d Results\n", p.count)
+	case "json":
+		results := make([]Result, len(matches))
+		for i, m := range matches {
+			results[i] = slashResult(m)
+		}
+
+		// Without parents or labels the output stays a plain list of paths
+		var data interface{} = resultPaths(results)
+		if p.group {
+			data = groupResults(p.templates, results)
+		} else if p.nested || p.labels || p.scores || len(p.columns) > 0 {
+			data = results
+		}
+		if err := p.enc.Encode(data); err != nil {
+			fmt.Fprintln(os.Stderr, "JSON encoding error:", err)
+		}
+	case "clear":
+		if p.deferred() {
+			for _, m := range matches {
+				p.line(slashResult(m))
+			}
+		}
+	case "ndjson":
+		if p.deferred() {
+			for _, m := range matches {
+				if err := p.enc.Encode(slashResult(m)); err != nil {
+					fmt.Fprintln(os.Stderr, "JSON encoding error:", err)
+				}
+			}
+		}
+	}
+}
+
+// table writes the selected columns of all matches aligned like the
+// output of check.
+func (p *printer) table(matches []Result) {
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+
+	headers := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		headers[i] = strings.ToUpper(c[:1]) + c[1:]
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+
+	for _, m := range matches {
+		m = slashResult(m)
+		values := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			values[i] = m.column(c)
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+
+	w.Flush()
+}
+
+// scored reports whether a template has optional files or folders or a
+// min score, so its results are ranked by score.
+func scored(template structure.Folder) bool {
+	if template.MinScore > 0 {
+		return true
+	}
+	for _, f := range template.Files {
+		if f.Existence == "optional" {
+			return true
+		}
+	}
+	for _, f := range template.Folders {
+		if f.Existence == "optional" {
+			return true
+		}
+	}
+	return false
+}
+
+// groups writes the results of every template below its own heading.
+func (p *printer) groups(matches []Result) {
+	grouped := groupResults(p.templates, matches)
+	for _, name := range p.templates {
+		fmt.Fprintf(p.out, "## %s (%d)\n", name, len(grouped[name]))
+		for _, path := range grouped[name] {
+			fmt.Fprintln(p.out, filepath.ToSlash(path))
+		}
+	}
+}
+
+// groupResults returns the paths of the results for every template. A
+// result which matched several templates is listed for each of them.
+func groupResults(templates []string, results []Result) map[string][]string {
+	grouped := map[string][]string{}
+	for _, name := range templates {
+		grouped[name] = []string{}
+	}
+	for _, r := range results {
+		for _, name := range r.Templates {
+			grouped[name] = append(grouped[name], r.Path)
+		}
+	}
+	return grouped
+}
+
+// interruptReason describes why a search was stopped early.
+func interruptReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "Search timed out"
+	}
+	return "Search interrupted"
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Result is a single directory which matched a template.
+type Result struct {
+	Path string `json:"path"`
+	// Names of the templates the directory matched
+	Templates []string `json:"templates,omitempty"`
+	// Nearest enclosing result, only set when searching with Options.Nested
+	Parent string `json:"parent,omitempty"`
+	// Score of the optional files and folders, the best one when the
+	// directory matched several templates
+	Score int `json:"score,omitempty"`
+
+	// Metadata, only filled for the selected Options.Columns
+	Size      int64      `json:"size,omitempty"`
+	FileCount int        `json:"files,omitempty"`
+	Modified  *time.Time `json:"modified,omitempty"` // Newest modification in the directory
+	Branch    string     `json:"branch,omitempty"`   // Checked out git branch
+}
+
+// SortKeys are the values for Options.Sort.
+var SortKeys = []string{"path", "name", "mtime", "size", "score"}
+
+// IsSortKey reports whether key is a supported sort key.
+func IsSortKey(key string) bool {
+	for _, k := range SortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sortResults sorts results by key: "path" and "name" (the last path
+// element) ascending, "mtime" newest first, "size" largest first and
+// "score" best first. The empty key sorts by score and path. Equal
+// results are sorted by path, so the order is always the same. reverse
+// reverses the whole order.
+func sortResults(results []Result, key string, reverse bool) {
+	less := func(a, b Result) bool {
+		switch key {
+		case "name":
+			if na, nb := filepath.Base(a.Path), filepath.Base(b.Path); na != nb {
+				return na < nb
+			}
+		case "mtime":
+			ta, tb := modTime(a), modTime(b)
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		case "size":
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case "score", "":
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		}
+		return a.Path < b.Path
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if reverse {
+			return less(results[j], results[i])
+		}
+		return less(results[i], results[j])
+	})
+}
+
+// modTime returns the modification time of a result, the zero time when
+// it was not collected.
+func modTime(r Result) time.Time {
+	if r.Modified == nil {
+		return time.Time{}
+	}
+	return *r.Modified
+}
+
+// resultPaths returns the paths of results.
+func resultPaths(results []Result) []string {
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.Path
+	}
+	return paths
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shadowdara/finder/pub/goansi"
+)
+
+// RunResult is the outcome of a command run by Run in one directory.
+type RunResult struct {
+	Path     string  `json:"path"`
+	ExitCode int     `json:"exit_code"`
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+	Error    string  `json:"error,omitempty"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// Run searches for templates like FindAll and then runs the command argv
+// in every found directory, Options.ExecJobs at the same time. argv is
+// run directly, not by a shell. When all commands are finished a table
+// with the exit code and output of every directory is printed, or with
+// output_type "json" and "ndjson" the RunResults. An ExecError is
+// returned when a command failed.
+func Run(ctx context.Context, templates []Template, argv []string, output_type string, opts Options) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+
+	searchCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	w := newWalker(templates, opts)
+	matches := w.run(searchCtx, opts.searchRoots())
+	if err := w.stopped; err != nil {
+		fmt.Fprintf(os.Stderr, "%s[WARNING] %s, no command was run%s\n",
+			goansi.YELLOW, interruptReason(err), goansi.END)
+		return err
+	}
+
+	dirs := resultPaths(matches)
+	if output_type == "normal" {
+		fmt.Printf("Running '%s' in %d directories ...\n", strings.Join(argv, " "), len(dirs))
+	}
+
+	results := runEach(ctx, dirs, opts.ExecJobs, func(dir string) *exec.Cmd {
+		cmd := userCommand(ctx, argv[0], argv[1:]...)
+		cmd.Dir = dir
+		return cmd
+	}, nil)
+
+	printRunResults(os.Stdout, results, output_type)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	failed := 0
+	for _, r := range results {
+		if r.failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return &ExecError{Failed: failed, Total: len(results)}
+	}
+	return nil
+}
+
+// runResult converts the result of runEach for the output.
+func runResult(r execResult) RunResult {
+	result := RunResult{
+		Path:     filepath.ToSlash(r.Dir),
+		ExitCode: r.ExitCode,
+		Stdout:   string(r.Stdout),
+		Stderr:   string(r.Stderr),
+		Seconds:  r.Duration.Seconds(),
+	}
+	if r.Err != nil {
+		result.Error = r.Err.Error()
+	}
+	return result
+}
+
+// printRunResults writes the results of Run to w.
+func printRunResults(w io.Writer, results []execResult, output_type string) {
+	switch output_type {
+	case "json", "ndjson":
+		list := make([]RunResult, len(results))
+		for i, r := range results {
+			list[i] = runResult(r)
+		}
+
+		enc := json.NewEncoder(w)
+		if output_type == "ndjson" {
+			for _, r := range list {
+				enc.Encode(r)
+			}
+			return
+		}
+		enc.SetIndent("", "  ")
+		enc.Encode(list)
+		return
+	case "clear":
+		// Tab separated columns: exit code, path
+		for _, r := range results {
+			fmt.Fprintf(w, "%d\t%s\n", r.ExitCode, filepath.ToSlash(r.Dir))
+		}
+		return
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(w, "0 succeeded, 0 failed")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	// Same escape codes in every row to keep the columns aligned
+	fmt.Fprintf(tw, "%sStatus%s\tExit\tTime\tDirectory\tOutput\n", goansi.WHITE, goansi.END)
+	failed := 0
+	for _, r := range results {
+		status := goansi.GREEN + "ok" + goansi.END
+		if r.failed() {
+			status = goansi.RED + "FAILED" + goansi.END
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.2fs\t%s\t%s\n", status, r.ExitCode, r.Duration.Seconds(),
+			filepath.ToSlash(r.Dir), summaryLine(r))
+	}
+	tw.Flush()
+
+	// The full error output of the failed commands which ran, the exit
+	// code of a failure without output is already in the table
+	for _, r := range results {
+		if !r.failed() || !r.Ran || (r.Err == nil && len(r.Stderr) == 0) {
+			continue
+		}
+		fmt.Fprintf(w, "\n## %s\n", filepath.ToSlash(r.Dir))
+		if r.Err != nil {
+			fmt.Fprintln(w, r.Err)
+		}
+		if len(r.Stderr) > 0 {
+			w.Write(r.Stderr)
+			if r.Stderr[len(r.Stderr)-1] != '\n' {
+				fmt.Fprintln(w)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d succeeded, %d failed\n", len(results)-failed, failed)
+}
+
+// summaryLine returns the last line of the output of a command for the
+// table, stderr for failed commands.
+func summaryLine(r execResult) string {
+	output := r.Stdout
+	if r.failed() && len(strings.TrimSpace(string(r.Stderr))) > 0 {
+		output = r.Stderr
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	// Cut runes, not bytes, to keep the line valid UTF-8
+	if runes := []rune(line); len(runes) > 60 {
+		line = string(runes[:57]) + "..."
+	}
+	return line
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRun_JSONOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+	if err := os.WriteFile(filepath.Join(root, "b", "fail"), nil, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	argv := []string{"sh", "-c", `basename "$(pwd)"; if [ -e fail ]; then echo broken >&2; exit 3; fi`}
+
+	var err error
+	output := captureSearchOutput(func() {
+		err = Run(context.Background(), []Template{{Folder: gitTemplate}}, argv, "json", Options{Roots: []string{root}})
+	})
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.Failed != 1 || execErr.Total != 2 {
+		t.Fatalf("expected 1 of 2 commands to fail, got %v", err)
+	}
+
+	var results []RunResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("expected a JSON array, got: %s (error: %v)", output, err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	a, b := results[0], results[1]
+	if a.Path != filepath.ToSlash(filepath.Join(root, "a")) || a.ExitCode != 0 || a.Stdout != "a\n" {
+		t.Errorf("unexpected result for a: %+v", a)
+	}
+	if b.Path != filepath.ToSlash(filepath.Join(root, "b")) || b.ExitCode != 3 || b.Stderr != "broken\n" {
+		t.Errorf("unexpected result for b: %+v", b)
+	}
+}
+
+func TestRun_NormalOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	var err error
+	output := captureSearchOutput(func() {
+		err = Run(context.Background(), []Template{{Folder: gitTemplate}}, []string{"true"}, "normal", Options{Roots: []string{root}})
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(output, filepath.ToSlash(filepath.Join(root, "a"))) || !strings.Contains(output, "1 succeeded, 0 failed") {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+func TestPrintRunResults_OnlyFailuresWithOutput(t *testing.T) {
+	results := []execResult{
+		{Dir: "/ok", Ran: true},
+		{Dir: "/silent", ExitCode: 1, Ran: true},
+		{Dir: "/loud", ExitCode: 1, Stderr: []byte("boom\n"), Ran: true},
+		{Dir: "/skipped", ExitCode: -1, Err: context.Canceled},
+	}
+
+	var b strings.Builder
+	printRunResults(&b, results, "normal")
+	out := b.String()
+
+	if !strings.Contains(out, "## /loud\nboom\n") {
+		t.Errorf("expected the error output of the failed command, got: %s", out)
+	}
+	for _, dir := range []string{"/ok", "/silent", "/skipped"} {
+		if strings.Contains(out, "## "+dir+"\n") {
+			t.Errorf("expected no section for %s, got: %s", dir, out)
+		}
+	}
+
+	b.Reset()
+	printRunResults(&b, nil, "normal")
+	if b.String() != "0 succeeded, 0 failed\n" {
+		t.Errorf("expected only the summary without results, got: %q", b.String())
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	r := execResult{Stdout: []byte("one\ntwo\n\n")}
+	if got := summaryLine(r); got != "two" {
+		t.Errorf("expected the last line of stdout, got %q", got)
+	}
+
+	r = execResult{Stdout: []byte("out\n"), Stderr: []byte("error\n"), ExitCode: 1}
+	if got := summaryLine(r); got != "error" {
+		t.Errorf("expected stderr for a failed command, got %q", got)
+	}
+
+	r = execResult{Stdout: []byte(strings.Repeat("x", 100))}
+	if got := summaryLine(r); len(got) != 60 || !strings.HasSuffix(got, "...") {
+		t.Errorf("expected a shortened line, got %q", got)
+	}
+
+	r = execResult{Stdout: []byte(strings.Repeat("ä", 100))}
+	if got := summaryLine(r); !utf8.ValidString(got) || utf8.RuneCountInString(got) != 60 {
+		t.Errorf("expected a shortened line of 60 runes, got %q", got)
+	}
+}
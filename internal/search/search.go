@@ -1,12 +1,10 @@
 package search
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"runtime"
-	"sync"
 	"time"
 
 	"github.com/shadowdara/finder/internal/finderversion"
@@ -34,88 +32,101 @@ func getSearchRoots() []string {
 	return []string{"/"}
 }
 
+// Template is a template together with the name it was loaded by. The
+// name is used to label the results.
+type Template struct {
+	Name   string
+	Folder structure.Folder
+}
+
 // Find searches the filesystem for directories that match the
 // provided
 // Folder template. Results are printed to stdout according
 // to output_type:
 // - "normal": human readable output with header and footer
 // - "json": a JSON array is emitted to stdout
+// - "ndjson": one JSON object per line for every match
 // - "clear": only paths are printed (useful for scripting)
 //
-// Search is performed asynchronously across all available drives/roots
-// for improved performance, especially with multiple drives.
-func Find(folderstruct structure.Folder, output_type string) {
-	if output_type != "clear" {
-		fmt.Printf("Description: %s\n", folderstruct.Description)
-
-		// If Version is to old
-		if /*folderstruct.MinVersion != "0.0.0" && */ !version.IsNewer(finderversion.Version, folderstruct.MinVersion) {
-			fmt.Printf("%s[WARNING] Your Version of finder is maybe to old for this Template! Something could go wrong!%s\n", goansi.YELLOW, goansi.END)
-		}
+// Except for "json" every match is printed as soon as it is found.
+// Search is performed in parallel across the roots from opts, or all
+// available drives when no roots are set.
+//
+// When ctx is done or the timeout from opts is over, the search stops,
+// the matches found so far are printed and the error of the context is
+// returned.
+func Find(ctx context.Context, folderstruct structure.Folder, output_type string, opts Options) error {
+	return FindAll(ctx, []Template{{Folder: folderstruct}}, output_type, opts)
+}
+
+// FindAll works like Find but searches for several templates during a
+// single walk. Every result is labeled with the names of the templates
+// it matched.
+func FindAll(ctx context.Context, templates []Template, output_type string, opts Options) error {
+	if opts.Executes() {
+		return findAndExec(ctx, templates, opts)
 	}
 
-	// Start timing
-	start := time.Now()
+	if output_type == "normal" {
+		for _, t := range templates {
+			if len(templates) > 1 {
+				fmt.Printf("Description (%s): %s\n", t.Name, t.Folder.Description)
+			} else {
+				fmt.Printf("Description: %s\n", t.Folder.Description)
+			}
 
-	roots := getSearchRoots()
-
-	// Use a channel to collect results from goroutines
-	resultsChan := make(chan []string)
-	var wg sync.WaitGroup
-
-	// Start a goroutine for each search root
-	for _, root := range roots {
-		wg.Add(1)
-		go func(searchRoot string) {
-			defer wg.Done()
-			// Search this root and send results back through the channel
-			matches := findMatchingFolders(searchRoot, folderstruct)
-			if len(matches) > 0 {
-				resultsChan <- matches
+			// If Version is to old
+			if /*folderstruct.MinVersion != "0.0.0" && */ !version.IsNewer(finderversion.Version, t.Folder.MinVersion) {
+				fmt.Printf("%s[WARNING] Your Version of finder is maybe to old for this Template! Something could go wrong!%s\n", goansi.YELLOW, goansi.END)
 			}
-		}(root)
+		}
 	}
 
-	// Wait for all goroutines to complete in a separate goroutine,
-	// then close the channel so the loop below will exit
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect all results from the channel
-	matches := []string{}
-	for results := range resultsChan {
-		matches = append(matches, results...)
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	// Normalize Windows backslashes to forward slashes for consistent output
-	for i, m := range matches {
-		matches[i] = filepath.ToSlash(m)
+	// Start timing
+	start := time.Now()
+
+	out := newPrinter(output_type, opts, templates)
+	out.header()
+
+	// All roots and templates share one walk
+	w := newWalker(templates, opts)
+	w.onMatch = out.match
+	matches := w.run(ctx, opts.searchRoots())
+
+	// A search which finished just before the timeout is complete
+	out.footer(matches, time.Since(start), w.stopped)
+	return w.stopped
+}
+
+// findAndExec searches like FindAll without printing the results and
+// runs the Exec or ExecBatch command of opts for them. The commands only
+// run when the search was complete, the timeout of opts only applies to
+// the search.
+func findAndExec(ctx context.Context, templates []Template, opts Options) error {
+	searchCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	// Calculate elapsed time
-	elapsed := time.Since(start).Seconds()
-	if output_type != "clear" {
-		fmt.Printf("Search by finder took: %.4f seconds\n", elapsed)
-		fmt.Printf("Found: %.d Results\n", len(matches))
+	w := newWalker(templates, opts)
+	matches := w.run(searchCtx, opts.searchRoots())
+	if err := w.stopped; err != nil {
+		fmt.Fprintf(os.Stderr, "%s[WARNING] %s, no command was run%s\n",
+			goansi.YELLOW, interruptReason(err), goansi.END)
+		return err
 	}
 
-	switch output_type {
-	case "normal":
-		fmt.Println("# Found:")
-		for _, m := range matches {
-			fmt.Println(m)
-		}
-		fmt.Println("# End of the List")
-	case "json":
-		enc := json.NewEncoder(os.Stdout)
-		if err := enc.Encode(matches); err != nil {
-			fmt.Println("JSON encoding error:", err)
-		}
-	case "clear":
-		for _, m := range matches {
-			fmt.Println(m)
-		}
+	err := runExec(ctx, matches, opts)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
 }
@@ -2,12 +2,16 @@ package search
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/shadowdara/finder/internal/structure"
 )
@@ -37,7 +41,7 @@ func TestFind_NormalOutput(t *testing.T) {
 	}
 
 	output := captureSearchOutput(func() {
-		Find(folder, "normal")
+		Find(context.Background(), folder, "normal", Options{Roots: []string{t.TempDir()}})
 	})
 
 	if !strings.Contains(output, "Description: Test Folder") {
@@ -60,7 +64,7 @@ func TestFind_ClearOutput(t *testing.T) {
 	}
 
 	output := captureSearchOutput(func() {
-		Find(folder, "clear")
+		Find(context.Background(), folder, "clear", Options{Roots: []string{t.TempDir()}})
 	})
 
 	// Clear output should not include description
@@ -78,7 +82,7 @@ func TestFind_JSONOutput(t *testing.T) {
 	}
 
 	output := captureSearchOutput(func() {
-		Find(folder, "json")
+		Find(context.Background(), folder, "json", Options{Roots: []string{t.TempDir()}})
 	})
 
 	// JSON output should be valid JSON array
@@ -270,7 +274,7 @@ func TestMatchAny_NoMatch(t *testing.T) {
 }
 
 func TestExecuteCommand_EmptyCommand(t *testing.T) {
-	result := executeCommand(t.TempDir(), "", false)
+	result := executeCommand(context.Background(), t.TempDir(), "", false)
 
 	if !result {
 		t.Errorf("expected empty command to return true")
@@ -279,7 +283,7 @@ func TestExecuteCommand_EmptyCommand(t *testing.T) {
 
 func TestExecuteCommand_ValidCommand(t *testing.T) {
 	// Use a simple command that should work on both Windows and Unix
-	result := executeCommand(t.TempDir(), "echo test", false)
+	result := executeCommand(context.Background(), t.TempDir(), "echo test", false)
 
 	if !result {
 		t.Errorf("expected 'echo test' command to succeed")
@@ -288,7 +292,7 @@ func TestExecuteCommand_ValidCommand(t *testing.T) {
 
 func TestExecuteCommand_InvertedCommand(t *testing.T) {
 	// This tests the inverted command flag
-	result := executeCommand(t.TempDir(), "echo test", true)
+	result := executeCommand(context.Background(), t.TempDir(), "echo test", true)
 
 	// Behavior depends on implementation
 	_ = result
@@ -303,7 +307,7 @@ func TestFindMatchingFolders_Empty(t *testing.T) {
 		Folders: []structure.Folder{},
 	}
 
-	matches := findMatchingFolders(tempDir, template)
+	matches := findMatchingFolders(context.Background(), tempDir, template, Options{})
 
 	if len(matches) != 0 {
 		t.Errorf("expected empty results for non-matching template, got %d matches", len(matches))
@@ -323,7 +327,7 @@ func TestFindMatchingFolders_SingleMatch(t *testing.T) {
 		Folders: []structure.Folder{},
 	}
 
-	matches := findMatchingFolders(tempDir, template)
+	matches := findMatchingFolders(context.Background(), tempDir, template, Options{})
 
 	if len(matches) != 1 {
 		t.Errorf("expected 1 match, got %d", len(matches))
@@ -350,9 +354,186 @@ func TestFindMatchingFolders_MultipleMatches(t *testing.T) {
 		Folders: []structure.Folder{},
 	}
 
-	matches := findMatchingFolders(tempDir, template)
+	matches := findMatchingFolders(context.Background(), tempDir, template, Options{})
 
 	if len(matches) == 0 {
 		t.Logf("no matches found (expected for wildcard in walk)")
 	}
 }
+
+func TestFind_NDJSONOutput(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+
+	output := captureSearchOutput(func() {
+		Find(context.Background(), gitTemplate, "ndjson", Options{Roots: []string{root}})
+	})
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per match, got: %s", output)
+	}
+	for _, line := range lines {
+		var m struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &m); err != nil || m.Path == "" {
+			t.Errorf("expected a JSON object with a path, got %q (error: %v)", line, err)
+		}
+	}
+}
+
+func TestFind_NormalOutputSummaryAtEnd(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	output := captureSearchOutput(func() {
+		Find(context.Background(), gitTemplate, "normal", Options{Roots: []string{root}})
+	})
+
+	found := strings.Index(output, "# Found:")
+	match := strings.Index(output, filepath.ToSlash(filepath.Join(root, "a")))
+	summary := strings.Index(output, "Found: 1 Results")
+	if found < 0 || match < found || summary < match {
+		t.Errorf("expected header, match and summary in this order, got: %s", output)
+	}
+}
+
+func TestWalker_OnMatchIsCalledForEveryMatch(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b", "c/d")
+
+	var mu sync.Mutex
+	var streamed []string
+
+	w := newWalker([]Template{{Name: "git", Folder: gitTemplate}}, Options{Jobs: 4})
+	w.onMatch = func(result Result) {
+		mu.Lock()
+		streamed = append(streamed, result.Path)
+		mu.Unlock()
+	}
+	matches := w.run(context.Background(), []string{root})
+
+	if len(streamed) != len(matches) || len(matches) != 3 {
+		t.Fatalf("expected 3 streamed matches, got %v and %v", streamed, matches)
+	}
+}
+
+func TestFindAll_GroupedJSONOutput(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+	if err := os.WriteFile(filepath.Join(root, "a", "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	templates := []Template{
+		{Name: "git", Folder: gitTemplate},
+		{Name: "npm", Folder: structure.Folder{Name: "*", Files: structure.Files{{Name: "package.json"}}}},
+		{Name: "none", Folder: structure.Folder{Name: "does-not-exist"}},
+	}
+
+	output := captureSearchOutput(func() {
+		FindAll(context.Background(), templates, "json", Options{Roots: []string{root}, Group: true})
+	})
+
+	var grouped map[string][]string
+	if err := json.Unmarshal([]byte(output), &grouped); err != nil {
+		t.Fatalf("expected a JSON object, got: %s (error: %v)", output, err)
+	}
+
+	a := filepath.ToSlash(filepath.Join(root, "a"))
+	if len(grouped["git"]) != 1 || grouped["git"][0] != a {
+		t.Errorf("expected git group with %q, got %v", a, grouped["git"])
+	}
+	if len(grouped["npm"]) != 1 || grouped["npm"][0] != a {
+		t.Errorf("expected npm group with %q, got %v", a, grouped["npm"])
+	}
+	if group, ok := grouped["none"]; !ok || len(group) != 0 {
+		t.Errorf("expected an empty group for a template without results, got %v", group)
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	results := func() []Result {
+		return []Result{
+			{Path: "/x/b", Size: 10, Score: 1, Modified: &older},
+			{Path: "/a/c", Size: 30, Score: 2, Modified: &newer},
+			{Path: "/y/a", Size: 10, Score: 1},
+		}
+	}
+
+	cases := []struct {
+		key     string
+		reverse bool
+		want    []string
+	}{
+		{"path", false, []string{"/a/c", "/x/b", "/y/a"}},
+		{"name", false, []string{"/y/a", "/x/b", "/a/c"}},
+		{"mtime", false, []string{"/a/c", "/x/b", "/y/a"}},
+		{"size", false, []string{"/a/c", "/x/b", "/y/a"}},
+		{"score", false, []string{"/a/c", "/x/b", "/y/a"}},
+		{"", false, []string{"/a/c", "/x/b", "/y/a"}},
+		{"path", true, []string{"/y/a", "/x/b", "/a/c"}},
+		{"size", true, []string{"/y/a", "/x/b", "/a/c"}},
+	}
+	for _, c := range cases {
+		r := results()
+		sortResults(r, c.key, c.reverse)
+		if got := resultPaths(r); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("sort %q (reverse %v): expected %v, got %v", c.key, c.reverse, c.want, got)
+		}
+	}
+}
+
+func TestFindAll_SortedNDJSONOutput(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a/z", "b/y", "c/x")
+
+	output := captureSearchOutput(func() {
+		FindAll(context.Background(), []Template{{Name: "git", Folder: gitTemplate}}, "ndjson",
+			Options{Roots: []string{root}, Sort: "name", Reverse: true})
+	})
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var m struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("expected a JSON object, got %q (error: %v)", line, err)
+		}
+		got = append(got, filepath.Base(m.Path))
+	}
+	if want := []string{"z", "y", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPrinter_ScoredTemplatesAreRanked(t *testing.T) {
+	scored := Template{Name: "go", Folder: structure.Folder{
+		Files: structure.Files{{Name: "README.md", Existence: "optional"}},
+	}}
+	plain := Template{Name: "git", Folder: gitTemplate}
+	for _, output := range []string{"normal", "clear", "ndjson"} {
+		if !newPrinter(output, Options{}, []Template{scored}).deferred() {
+			t.Errorf("%s: expected a scored template to print the ranked results at the end", output)
+		}
+		if newPrinter(output, Options{}, []Template{plain}).deferred() {
+			t.Errorf("%s: expected a template without a score to be streamed", output)
+		}
+	}
+}
+
+func TestPrinter_GroupOnlyDefersNormalOutput(t *testing.T) {
+	templates := []Template{{Name: "git"}, {Name: "npm"}}
+	if !newPrinter("normal", Options{Group: true}, templates).deferred() {
+		t.Errorf("expected grouped normal output to print at the end")
+	}
+	for _, output := range []string{"clear", "ndjson"} {
+		if newPrinter(output, Options{Group: true}, templates).deferred() {
+			t.Errorf("%s: expected --group to keep streaming", output)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Up checks start and each of its parent directories against t, without
+// walking down into any of them. It returns the nearest matching
+// directory first. Unless all is set it stops at the first match.
+func Up(ctx context.Context, start string, t Template, all bool) ([]string, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	commands := newCommandRunner(NewOptions())
+	matches := []string{}
+	for {
+		if ctx.Err() != nil {
+			return matches, ctx.Err()
+		}
+
+		if entries, err := os.ReadDir(dir); err == nil {
+			if ok, _ := matchTemplate(ctx, commands, t, dir, dir, entries); ok {
+				matches = append(matches, dir)
+				if !all {
+					break
+				}
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestUp(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "a/b")
+	start := filepath.Join(root, "a", "b", "c")
+	makeGitRepos(t, start, "d")
+
+	tpl := Template{Name: "git", Folder: gitTemplate}
+
+	matches, err := Up(context.Background(), start, tpl, false)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != filepath.Join(root, "a", "b") {
+		t.Fatalf("expected the nearest enclosing repo, got %v", matches)
+	}
+
+	// A start directory which matches itself is found too
+	matches, err = Up(context.Background(), filepath.Join(root, "a"), tpl, false)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != filepath.Join(root, "a") {
+		t.Fatalf("expected the start directory, got %v", matches)
+	}
+
+	matches, err = Up(context.Background(), start, tpl, true)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(matches) < 2 || matches[0] != filepath.Join(root, "a", "b") || matches[1] != filepath.Join(root, "a") {
+		t.Fatalf("expected all enclosing repos nearest first, got %v", matches)
+	}
+}
+
+func TestUp_NoMatch(t *testing.T) {
+	tpl := Template{Name: "none", Folder: gitTemplate}
+	tpl.Folder.Name = "finder-test-does-not-exist"
+
+	matches, err := Up(context.Background(), t.TempDir(), tpl, true)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("expected no matches, got %v", matches)
+	}
+
+	if _, err := Up(context.Background(), filepath.Join(t.TempDir(), "missing"), tpl, false); err == nil {
+		t.Fatalf("expected an error for a missing start directory")
+	}
+}
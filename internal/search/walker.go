@@ -0,0 +1,373 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// walker searches the directories below one or more roots for matches
+// of one or more templates. Directory reads are spread over a bounded
+// pool of workers and every directory is read only once: the entries
+// are used both for matching all templates and for finding the
+// subdirectories to walk next.
+type walker struct {
+	templates []Template
+	opts      Options
+	maxDepth  []int  // max depth per template, 0 is unlimited
+	prune     []bool // prune_matches per template
+	commands  *commandRunner
+
+	// Called for every match while the walk is running
+	onMatch func(result Result)
+	// Called for every directory which was read, before it is matched
+	onDir func(path string)
+
+	mu      sync.Mutex
+	matches []Result
+
+	// The error of the context when the last walk stopped before every
+	// directory was visited, nil when it was complete
+	stopped error
+}
+
+// walkJob is a directory waiting to be read by a worker.
+type walkJob struct {
+	path    string
+	depth   int
+	exclude *excluder
+	ignore  []excludeRule // rules from the ignore files of all parents
+	parent  string        // nearest parent directory which matched
+	active  []bool        // templates which are still searched here
+}
+
+// newWalker prepares a walk for templates. Options which can also be set
+// in a template are resolved per template here.
+func newWalker(templates []Template, opts Options) *walker {
+	w := &walker{
+		opts:     opts,
+		commands: newCommandRunner(opts),
+	}
+
+	for _, t := range templates {
+		t = opts.template(t)
+		w.templates = append(w.templates, t)
+		w.maxDepth = append(w.maxDepth, opts.maxDepth(t.Folder))
+		w.prune = append(w.prune, opts.PruneMatches || t.Folder.PruneMatches)
+	}
+
+	return w
+}
+
+// run walks all roots and returns the matching directories sorted by
+// Options.Sort, so the result does not depend on the timing of the
+// workers.
+// When ctx is done the workers stop and the matches found so far are
+// returned. Directories which were read again for the index of the
+// options are saved to it at the end.
+func (w *walker) run(ctx context.Context, roots []string) []Result {
+	var jobs []walkJob
+	for _, root := range roots {
+		jobs = append(jobs, w.rootJob(root))
+	}
+	return w.walk(ctx, jobs)
+}
+
+// rootJob returns the job which starts the walk of root.
+func (w *walker) rootJob(root string) walkJob {
+	active := make([]bool, len(w.templates))
+	for i := range active {
+		active[i] = true
+	}
+
+	return walkJob{
+		path:    root,
+		exclude: newExcluder(root, w.templates, w.opts),
+		active:  active,
+	}
+}
+
+// walk runs the workers until jobs and all directories below them are
+// visited and returns the matches like run.
+func (w *walker) walk(ctx context.Context, jobs []walkJob) []Result {
+	// Also stops the goroutine of the queue when the walk is finished
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := newJobQueue(ctx)
+	for _, job := range jobs {
+		queue.push(job)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.jobs(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := queue.pop()
+				if !ok {
+					return
+				}
+				w.visit(ctx, job, queue)
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+	w.stopped = queue.stopped()
+
+	if w.opts.Index != nil {
+		w.opts.Index.saveChanges()
+	}
+
+	if w.matches == nil {
+		w.matches = []Result{}
+	}
+	sortResults(w.matches, w.opts.Sort, w.opts.Reverse)
+	return w.matches
+}
+
+// visit reads one directory, checks it against the active templates and
+// queues its subdirectories.
+func (w *walker) visit(ctx context.Context, job walkJob, queue *jobQueue) {
+	entries, err := w.readDir(job.path)
+	if err != nil {
+		return
+	}
+	if w.onDir != nil {
+		w.onDir(job.path)
+	}
+
+	// Templates which are still searched below this directory
+	active := job.active
+	parent := job.parent
+
+	if job.depth >= w.opts.MinDepth {
+		var matched []string
+		best := 0
+		for i, t := range w.templates {
+			if !job.active[i] {
+				continue
+			}
+			ok, score := matchTemplate(ctx, w.commands, t, job.exclude.root, job.path, entries)
+			if !ok {
+				continue
+			}
+			if len(matched) == 0 || score > best {
+				best = score
+			}
+			matched = append(matched, t.Name)
+
+			// Nothing below a match of this template is reported
+			if w.prune[i] {
+				active = without(active, i)
+			}
+		}
+
+		if len(matched) > 0 {
+			w.report(job, matched, best)
+			parent = job.path
+		}
+	}
+
+	// Do not descend below the max depth of a template
+	for i := range w.templates {
+		if active[i] && w.maxDepth[i] > 0 && job.depth >= w.maxDepth[i] {
+			active = without(active, i)
+		}
+	}
+	if !anyActive(active) {
+		return
+	}
+
+	ignore := ignoreRules(job.path, entries, job.ignore)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		child := filepath.Join(job.path, e.Name())
+		if job.exclude.excluded(child, ignore) {
+			continue
+		}
+
+		childActive := active
+		for i := range w.templates {
+			if childActive[i] && job.exclude.skipped(i, child) {
+				childActive = without(childActive, i)
+			}
+		}
+		if !anyActive(childActive) {
+			continue
+		}
+
+		queue.push(walkJob{
+			path:    child,
+			depth:   job.depth + 1,
+			exclude: job.exclude,
+			ignore:  ignore,
+			parent:  parent,
+			active:  childActive,
+		})
+	}
+}
+
+// readDir reads the entries of a directory from the index of the
+// options or from the disk.
+func (w *walker) readDir(dirPath string) ([]os.DirEntry, error) {
+	if w.opts.Index != nil {
+		entries, _, err := w.opts.Index.readDir(dirPath)
+		return entries, err
+	}
+	return os.ReadDir(dirPath)
+}
+
+// report stores and streams a result for a directory which matched the
+// named templates. score is the best score of these templates.
+func (w *walker) report(job walkJob, templates []string, score int) {
+	result := Result{Path: job.path, Templates: templates, Score: score}
+	if w.opts.Nested {
+		result.Parent = job.parent
+	}
+	if fields := w.opts.metadata(); len(fields) > 0 {
+		addMetadata(&result, fields)
+	}
+
+	w.mu.Lock()
+	w.matches = append(w.matches, result)
+	w.mu.Unlock()
+
+	if w.onMatch != nil {
+		w.onMatch(result)
+	}
+}
+
+// matchTemplate checks a directory below root with its already read
+// entries against a template and runs the template command with
+// commands. score is the score of the optional files and folders of the
+// template.
+func matchTemplate(ctx context.Context, commands *commandRunner, t Template, root, dirPath string, entries []os.DirEntry) (matched bool, score int) {
+	if !matchFolderName(dirPath, t.Folder) {
+		return false, 0
+	}
+	if matched, score = matchFolderEntries(dirPath, entries, t.Folder, nil); !matched {
+		return false, 0
+	}
+	return commands.run(ctx, t, root, dirPath, nil), score
+}
+
+// without returns a copy of active with the template i disabled. The
+// slice is shared between sibling jobs, so it is never changed in place.
+func without(active []bool, i int) []bool {
+	c := make([]bool, len(active))
+	copy(c, active)
+	c[i] = false
+	return c
+}
+
+// anyActive reports whether at least one template is still searched.
+func anyActive(active []bool) bool {
+	for _, a := range active {
+		if a {
+			return true
+		}
+	}
+	return false
+}
+
+// jobs returns the number of workers for a walk.
+func (opts Options) jobs() int {
+	if opts.Jobs > 0 {
+		return opts.Jobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// jobQueue is an unbounded stack of directories. Workers push the
+// subdirectories they find, so a bounded channel could deadlock. Using
+// a stack walks depth first and keeps the queue small.
+type jobQueue struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    []walkJob
+	pending int   // pushed jobs which are not done yet
+	err     error // error of ctx when the last job was done
+}
+
+func newJobQueue(ctx context.Context) *jobQueue {
+	q := &jobQueue{ctx: ctx}
+	q.cond = sync.NewCond(&q.mu)
+
+	// Wake up all waiting workers when the search is stopped
+	go func() {
+		<-ctx.Done()
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}()
+
+	return q
+}
+
+func (q *jobQueue) push(job walkJob) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop waits for the next job. It returns false when all jobs are done
+// or the context of the queue is done.
+func (q *jobQueue) pop() (walkJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.ctx.Err() != nil {
+			return walkJob{}, false
+		}
+		if len(q.jobs) > 0 {
+			break
+		}
+		if q.pending == 0 {
+			return walkJob{}, false
+		}
+		q.cond.Wait()
+	}
+
+	job := q.jobs[len(q.jobs)-1]
+	q.jobs = q.jobs[:len(q.jobs)-1]
+	return job, true
+}
+
+// stopped returns the error of the context when it was done before all
+// jobs were, nil when every job was finished in time.
+func (q *jobQueue) stopped() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == 0 {
+		return q.err
+	}
+	return q.ctx.Err()
+}
+
+// done marks a popped job as finished.
+func (q *jobQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	finished := q.pending == 0
+	if finished {
+		q.err = q.ctx.Err()
+	}
+	q.mu.Unlock()
+
+	if finished {
+		q.cond.Broadcast()
+	}
+}
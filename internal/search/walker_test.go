@@ -0,0 +1,297 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestWalker_ResultsAreSortedAndStable(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for i := 0; i < 20; i++ {
+		dirs = append(dirs, fmt.Sprintf("p%02d", i), fmt.Sprintf("p%02d/nested/q", i))
+	}
+	makeGitRepos(t, root, dirs...)
+
+	first := findMatchingFolders(context.Background(), root, gitTemplate, Options{Jobs: 8})
+	if len(first) != 40 {
+		t.Fatalf("expected 40 matches, got %d", len(first))
+	}
+
+	for i := 1; i < len(first); i++ {
+		if first[i-1] > first[i] {
+			t.Fatalf("expected sorted results, got %q before %q", first[i-1], first[i])
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		again := findMatchingFolders(context.Background(), root, gitTemplate, Options{Jobs: 8})
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("expected the same results on every run")
+		}
+	}
+
+	single := findMatchingFolders(context.Background(), root, gitTemplate, Options{Jobs: 1})
+	if !reflect.DeepEqual(first, single) {
+		t.Fatalf("expected the same results with one job")
+	}
+}
+
+func TestWalker_MultipleRootsShareOnePool(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	makeGitRepos(t, a, "x")
+	makeGitRepos(t, b, "y", "z")
+
+	want := []string{filepath.Join(a, "x"), filepath.Join(b, "y"), filepath.Join(b, "z")}
+	sort.Strings(want)
+
+	matches := resultPaths(newWalker([]Template{{Name: "git", Folder: gitTemplate}}, Options{Jobs: 2}).run(context.Background(), []string{a, b}))
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("expected %v, got %v", want, matches)
+	}
+}
+
+func TestJobQueue_EmptyQueueFinishes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newJobQueue(ctx)
+	if _, ok := q.pop(); ok {
+		t.Fatalf("expected pop on an empty queue to report no job")
+	}
+}
+
+func TestJobQueue_StoppedOnlyWhenJobsAreLeft(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := newJobQueue(ctx)
+	q.push(walkJob{})
+	q.push(walkJob{})
+
+	q.pop()
+	q.done()
+	cancel()
+	if err := q.stopped(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled with a job left, got %v", err)
+	}
+
+	// A walk which finished before the context was done is complete
+	ctx, cancel = context.WithCancel(context.Background())
+	q = newJobQueue(ctx)
+	q.push(walkJob{})
+	q.pop()
+	q.done()
+	cancel()
+	if err := q.stopped(); err != nil {
+		t.Fatalf("expected no error for a finished queue, got %v", err)
+	}
+}
+
+func TestWalker_StopsWhenContextIsDone(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	matches := findMatchingFolders(ctx, root, gitTemplate, Options{})
+	if len(matches) != 0 {
+		t.Fatalf("expected no matches for a cancelled search, got %v", matches)
+	}
+}
+
+func TestFind_ReturnsContextError(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var err error
+	output := captureSearchOutput(func() {
+		err = Find(ctx, gitTemplate, "normal", Options{Roots: []string{root}})
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !strings.Contains(output, "Search interrupted") {
+		t.Errorf("expected interrupted footer, got: %s", output)
+	}
+}
+
+func TestFind_Timeout(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	// The command takes longer than the timeout and is killed
+	tpl := gitTemplate
+	tpl.Command = "sleep 5"
+	if runtime.GOOS == "windows" {
+		tpl.Command = "ping -n 6 127.0.0.1"
+	}
+
+	start := time.Now()
+	var err error
+	captureSearchOutput(func() {
+		err = Find(context.Background(), tpl, "clear", Options{Roots: []string{root}, Timeout: 100 * time.Millisecond})
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected the command to be killed at the timeout")
+	}
+}
+
+func TestWalker_PruneMatches(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "app", "app/examples/demo", "other")
+
+	matches := findMatchingFolders(context.Background(), root, gitTemplate, Options{PruneMatches: true})
+	want := []string{filepath.Join(root, "app"), filepath.Join(root, "other")}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("expected %v, got %v", want, matches)
+	}
+
+	// The template can enable it too
+	tpl := gitTemplate
+	tpl.PruneMatches = true
+	matches = findMatchingFolders(context.Background(), root, tpl, Options{})
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("expected template prune_matches to work, got %v", matches)
+	}
+}
+
+func TestWalker_NestedReportsParent(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "app", "app/libs/x", "app/libs/x/deep", "other")
+
+	results := newWalker([]Template{{Name: "git", Folder: gitTemplate}}, Options{Nested: true}).run(context.Background(), []string{root})
+
+	parents := map[string]string{}
+	for _, r := range results {
+		parents[r.Path] = r.Parent
+	}
+
+	app := filepath.Join(root, "app")
+	x := filepath.Join(app, "libs", "x")
+	cases := map[string]string{
+		app:                          "",
+		x:                            app,
+		filepath.Join(x, "deep"):     x,
+		filepath.Join(root, "other"): "",
+	}
+	for path, parent := range cases {
+		got, ok := parents[path]
+		if !ok {
+			t.Errorf("expected %q in results", path)
+			continue
+		}
+		if got != parent {
+			t.Errorf("expected parent of %q to be %q, got %q", path, parent, got)
+		}
+	}
+}
+
+func TestWalker_MultipleTemplatesInOneWalk(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "both", "gitonly")
+	if err := os.WriteFile(filepath.Join(root, "both", "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "npmonly"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "npmonly", "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	npm := structure.Folder{Name: "*", Files: structure.Files{{Name: "package.json"}}}
+	results := newWalker([]Template{
+		{Name: "git", Folder: gitTemplate},
+		{Name: "npm", Folder: npm},
+	}, Options{}).run(context.Background(), []string{root})
+
+	want := map[string][]string{
+		filepath.Join(root, "both"):    {"git", "npm"},
+		filepath.Join(root, "gitonly"): {"git"},
+		filepath.Join(root, "npmonly"): {"npm"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %v", len(want), results)
+	}
+	for _, r := range results {
+		if !reflect.DeepEqual(r.Templates, want[r.Path]) {
+			t.Errorf("expected %q to match %v, got %v", r.Path, want[r.Path], r.Templates)
+		}
+	}
+}
+
+func TestWalker_TemplateLimitsOnlyApplyToTheirTemplate(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "a/b", "archive")
+
+	shallow := gitTemplate
+	shallow.MaxDepth = 1
+	skipping := gitTemplate
+	skipping.Skip = []string{"archive"}
+
+	results := newWalker([]Template{
+		{Name: "shallow", Folder: shallow},
+		{Name: "skipping", Folder: skipping},
+	}, Options{}).run(context.Background(), []string{root})
+
+	got := map[string][]string{}
+	for _, r := range results {
+		got[r.Path] = r.Templates
+	}
+
+	want := map[string][]string{
+		filepath.Join(root, "a"):       {"shallow", "skipping"},
+		filepath.Join(root, "a", "b"):  {"skipping"},
+		filepath.Join(root, "archive"): {"shallow"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWalker_SortsByScore(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a", "b", "c")
+	for _, file := range []string{"b/README.md", "c/README.md", "c/LICENSE"} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte("x"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	tpl := gitTemplate
+	tpl.Files = structure.Files{
+		{Name: "README.md", Existence: "optional"},
+		{Name: "LICENSE", Existence: "optional"},
+	}
+
+	results := newWalker([]Template{{Folder: tpl}}, Options{}).run(context.Background(), []string{root})
+
+	want := []string{"c", "b", "a"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %v", len(want), results)
+	}
+	for i, name := range want {
+		if results[i].Path != filepath.Join(root, name) || results[i].Score != 2-i {
+			t.Errorf("result %d: expected %s with score %d, got %+v", i, name, 2-i, results[i])
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+	"github.com/shadowdara/finder/pub/goansi"
+)
+
+// watchDelay is how long Watch waits after the last change before it
+// checks the changed directories, so a git clone is checked once.
+const watchDelay = 200 * time.Millisecond
+
+// WatchEvent is a directory which started or stopped matching the
+// template of Watch.
+type WatchEvent struct {
+	Event    string `json:"event"` // "added" or "removed"
+	Path     string `json:"path"`
+	Template string `json:"template"`
+}
+
+// fsEvent is a change in a watched directory reported by a notifier.
+type fsEvent struct {
+	Dir      string // the watched directory
+	Name     string // the changed entry in Dir
+	IsDir    bool
+	Created  bool // the entry was created or moved into Dir
+	Removed  bool // the entry was deleted or moved out of Dir
+	Overflow bool // changes were lost, everything has to be checked again
+}
+
+// notifier reports the changes in the directories it watches. It is
+// implemented per platform, see newNotifier.
+type notifier interface {
+	add(dir string) error
+	events() <-chan []fsEvent
+	close() error
+}
+
+// Watch searches root for the template like Find and then keeps
+// watching it. Every directory which starts or stops matching is
+// printed as "+path" or "-path", or as a WatchEvent for "ndjson". The
+// matches of the first search are printed as added. Watch returns nil
+// when ctx is done.
+//
+// A directory is checked again when an entry in it or in the folders
+// of the template below it changes. For templates with size, age or
+// content rules or a command, written files count as changes as well,
+// and folder size and age rules check all parents up to root. A
+// command is not run again when something outside of these directories
+// changes its result.
+func Watch(ctx context.Context, t Template, root string, output_type string, opts Options) error {
+	n, err := newNotifier(readsFiles(opts.template(t).Folder))
+	if err != nil {
+		return err
+	}
+	defer n.close()
+
+	w := newWatcher(t, root, opts, n, watchPrinter(output_type, os.Stdout))
+	if output_type == "normal" {
+		fmt.Fprintf(os.Stderr, "# Watching %s for %s, Ctrl-C to stop\n", filepath.ToSlash(w.root), t.Name)
+	}
+	w.scan(ctx, []string{w.root})
+
+	return w.run(ctx)
+}
+
+// watchPrinter returns the function which writes the events of Watch to
+// out.
+func watchPrinter(output_type string, out io.Writer) func(WatchEvent) {
+	enc := json.NewEncoder(out)
+	return func(ev WatchEvent) {
+		ev.Path = filepath.ToSlash(ev.Path)
+		switch output_type {
+		case "ndjson":
+			if err := enc.Encode(ev); err != nil {
+				fmt.Fprintln(os.Stderr, "JSON encoding error:", err)
+			}
+		case "clear":
+			if ev.Event == "added" {
+				fmt.Fprintln(out, "+"+ev.Path)
+			} else {
+				fmt.Fprintln(out, "-"+ev.Path)
+			}
+		default:
+			if ev.Event == "added" {
+				fmt.Fprintf(out, "%s+%s%s\n", goansi.GREEN, ev.Path, goansi.END)
+			} else {
+				fmt.Fprintf(out, "%s-%s%s\n", goansi.RED, ev.Path, goansi.END)
+			}
+		}
+	}
+}
+
+// watcher keeps the matches of a template below root up to date with
+// the changes reported by a notifier.
+type watcher struct {
+	t        Template
+	opts     Options
+	root     string
+	depth    int  // how deep the folders of the template are nested
+	tree     bool // folder rules check everything below, so all parents are checked
+	exclude  *excluder
+	commands *commandRunner
+	notify   notifier
+	emit     func(WatchEvent)
+
+	matches map[string]bool
+	warned  sync.Once
+}
+
+func newWatcher(t Template, root string, opts Options, n notifier, emit func(WatchEvent)) *watcher {
+	root = normalizeRoots([]string{root})[0]
+	return &watcher{
+		t:        opts.template(t),
+		opts:     opts,
+		root:     root,
+		depth:    nestingDepth(t.Folder),
+		tree:     checksTree(opts.template(t).Folder),
+		exclude:  newExcluder(root, []Template{t}, opts),
+		commands: newCommandRunner(opts),
+		notify:   n,
+		emit:     emit,
+		matches:  map[string]bool{},
+	}
+}
+
+// run checks the changes of the notifier until ctx is done. Changes are
+// collected until none came for watchDelay.
+func (w *watcher) run(ctx context.Context) error {
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	var pending []fsEvent
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case batch, ok := <-w.notify.events():
+			if !ok {
+				return nil
+			}
+			pending = append(pending, batch...)
+			timer.Reset(watchDelay)
+		case <-timer.C:
+			w.handle(ctx, pending)
+			pending = nil
+		}
+	}
+}
+
+// handle updates the matches for a list of changes. Removed directories
+// drop all matches below them, new directories are searched and watched
+// and the directories which changed are checked again together with
+// the parents whose nested folders could have changed.
+func (w *watcher) handle(ctx context.Context, events []fsEvent) {
+	var created []string
+	changed := map[string]bool{}
+
+	for _, ev := range events {
+		if ev.Overflow {
+			w.rescan(ctx)
+			return
+		}
+
+		path := filepath.Join(ev.Dir, ev.Name)
+		if ev.IsDir && ev.Removed {
+			w.removeBelow(path)
+		}
+		if ev.IsDir && ev.Created && w.searched(path) {
+			created = append(created, path)
+		}
+
+		dir := ev.Dir
+		for i := 0; (w.tree || i <= w.depth) && isWithin(w.root, dir); i++ {
+			changed[dir] = true
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	w.scan(ctx, created)
+
+	dirs := make([]string, 0, len(changed))
+	for dir := range changed {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		w.recheck(ctx, dir)
+	}
+}
+
+// scan searches and watches the directories below dirs and adds their
+// matches.
+func (w *watcher) scan(ctx context.Context, dirs []string) {
+	if len(dirs) == 0 {
+		return
+	}
+
+	for _, r := range w.search(ctx, dirs) {
+		w.update(r.Path, true)
+	}
+}
+
+// rescan searches the whole root again after changes were lost.
+func (w *watcher) rescan(ctx context.Context) {
+	results := w.search(ctx, []string{w.root})
+	found := map[string]bool{}
+	for _, r := range results {
+		found[r.Path] = true
+	}
+
+	for _, path := range w.sortedMatches() {
+		if !found[path] {
+			w.update(path, false)
+		}
+	}
+	for _, r := range results {
+		w.update(r.Path, true)
+	}
+}
+
+// search walks dirs like Find and watches every directory it reads.
+func (w *watcher) search(ctx context.Context, dirs []string) []Result {
+	walk := newWalker([]Template{w.t}, w.opts)
+	walk.commands = w.commands
+	walk.onDir = func(path string) {
+		if err := w.notify.add(path); err != nil {
+			w.warned.Do(func() {
+				fmt.Fprintf(os.Stderr, "%s[WARNING] could not watch %s: %v, changes in some directories are missed%s\n",
+					goansi.YELLOW, path, err, goansi.END)
+			})
+		}
+	}
+
+	var jobs []walkJob
+	for _, dir := range dirs {
+		job := walk.rootJob(w.root)
+		job.path = dir
+		job.depth = depthBelow(w.root, dir)
+		jobs = append(jobs, job)
+	}
+
+	var results []Result
+	for _, r := range walk.walk(ctx, jobs) {
+		if !w.pruned(r.Path) {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// recheck matches a single directory again.
+func (w *watcher) recheck(ctx context.Context, dir string) {
+	matched := false
+	if w.searched(dir) && depthBelow(w.root, dir) >= w.opts.MinDepth && !w.pruned(dir) {
+		if entries, err := os.ReadDir(dir); err == nil {
+			matched, _ = matchTemplate(ctx, w.commands, w.t, w.root, dir, entries)
+		}
+	}
+
+	w.update(dir, matched)
+}
+
+// searched reports whether dir is within the max depth and not
+// excluded. Only the rules of ignore files are not checked.
+func (w *watcher) searched(dir string) bool {
+	maxDepth := w.opts.maxDepth(w.t.Folder)
+	if maxDepth > 0 && depthBelow(w.root, dir) > maxDepth {
+		return false
+	}
+	return !w.exclude.excluded(dir, nil) && !w.exclude.skipped(0, dir)
+}
+
+// removeBelow removes the matches at or below dir.
+func (w *watcher) removeBelow(dir string) {
+	for _, path := range w.sortedMatches() {
+		if isWithin(dir, path) {
+			w.update(path, false)
+		}
+	}
+}
+
+// update records whether path matches and emits an event when that
+// changed.
+func (w *watcher) update(path string, matched bool) {
+	if w.matches[path] == matched {
+		return
+	}
+
+	event := "removed"
+	if matched {
+		event = "added"
+		w.matches[path] = true
+	} else {
+		delete(w.matches, path)
+	}
+	w.emit(WatchEvent{Event: event, Path: path, Template: w.t.Name})
+}
+
+// pruned reports whether path lies below a match while matches are
+// pruned.
+func (w *watcher) pruned(path string) bool {
+	if !w.opts.PruneMatches && !w.t.Folder.PruneMatches {
+		return false
+	}
+	for dir := filepath.Dir(path); isWithin(w.root, dir); dir = filepath.Dir(dir) {
+		if w.matches[dir] {
+			return true
+		}
+		if dir == w.root {
+			break
+		}
+	}
+	return false
+}
+
+// sortedMatches returns the current matches sorted by path.
+func (w *watcher) sortedMatches() []string {
+	paths := make([]string, 0, len(w.matches))
+	for path := range w.matches {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// readsFiles reports whether a template has rules which depend on more
+// than the names of the entries: sizes, ages, contents or a command.
+func readsFiles(template structure.Folder) bool {
+	if template.Command != "" || checksTree(template) {
+		return true
+	}
+	for _, file := range template.Files {
+		if file.DataSize.Min > 0 || file.DataSize.Max > 0 ||
+			hasAge(file.ModifiedWithin, file.ModifiedBefore) || hasContentRule(file) {
+			return true
+		}
+	}
+	for _, f := range template.Folders {
+		if readsFiles(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// checksTree reports whether the template or one of its folders has a
+// size or age rule, which depends on everything below the folder.
+func checksTree(template structure.Folder) bool {
+	if template.DataSize.Min > 0 || template.DataSize.Max > 0 ||
+		hasAge(template.ModifiedWithin, template.ModifiedBefore) {
+		return true
+	}
+	for _, f := range template.Folders {
+		if checksTree(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestingDepth returns how many levels of folders a template describes
+// below the matched directory.
+func nestingDepth(template structure.Folder) int {
+	depth := 0
+	for _, f := range template.Folders {
+		if d := nestingDepth(f) + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
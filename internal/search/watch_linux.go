@@ -0,0 +1,151 @@
+//go:build linux
+
+package search
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask are the changes which can make a directory start or stop
+// matching.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// inotifyContentMask are the additional changes for templates which
+// read the files: written files and changed modification times.
+const inotifyContentMask = syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB
+
+// inotify is the notifier for Linux.
+type inotify struct {
+	fd   int
+	mask uint32
+	file *os.File // the non-blocking fd, so close stops a waiting read
+	ch   chan []fsEvent
+	done chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor -> directory
+}
+
+// newNotifier starts an inotify instance. With contents it also reports
+// written files.
+func newNotifier(contents bool) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	n := &inotify{
+		fd:   fd,
+		mask: inotifyMask,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		ch:   make(chan []fsEvent),
+		done: make(chan struct{}),
+		dirs: map[int]string{},
+	}
+	if contents {
+		n.mask |= inotifyContentMask
+	}
+	go n.read()
+
+	return n, nil
+}
+
+func (n *inotify) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, n.mask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	n.mu.Lock()
+	n.dirs[wd] = dir
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *inotify) events() <-chan []fsEvent {
+	return n.ch
+}
+
+func (n *inotify) close() error {
+	close(n.done)
+	return n.file.Close()
+}
+
+// read sends the events of every read from the inotify fd as one batch
+// until the notifier is closed.
+func (n *inotify) read() {
+	defer close(n.ch)
+
+	buf := make([]byte, 64*1024)
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		var batch []fsEvent
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(raw.Len)
+
+			name := ""
+			if raw.Len > 0 && offset <= count {
+				name = strings.TrimRight(string(buf[start:offset]), "\x00")
+			}
+			if ev, ok := n.event(int(raw.Wd), raw.Mask, name); ok {
+				batch = append(batch, ev)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		select {
+		case n.ch <- batch:
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// event converts a raw inotify event. Events of a watched directory
+// itself are dropped, its parent reports them.
+func (n *inotify) event(wd int, mask uint32, name string) (fsEvent, bool) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		return fsEvent{Overflow: true}, true
+	}
+
+	n.mu.Lock()
+	dir, ok := n.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.dirs, wd)
+	}
+	n.mu.Unlock()
+
+	if !ok || mask&syscall.IN_IGNORED != 0 {
+		return fsEvent{}, false
+	}
+	if mask&syscall.IN_MOVE_SELF != 0 {
+		// The path is wrong now, a new watch is added when the
+		// directory was moved to a watched directory
+		syscall.InotifyRmWatch(n.fd, uint32(wd))
+		return fsEvent{}, false
+	}
+	if mask&syscall.IN_DELETE_SELF != 0 {
+		return fsEvent{}, false
+	}
+
+	return fsEvent{
+		Dir:     dir,
+		Name:    name,
+		IsDir:   mask&syscall.IN_ISDIR != 0,
+		Created: mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0,
+		Removed: mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0,
+	}, true
+}
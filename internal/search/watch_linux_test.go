@@ -0,0 +1,101 @@
+//go:build linux
+
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+func TestWatcher_Inotify(t *testing.T) {
+	root := t.TempDir()
+
+	n, err := newNotifier(false)
+	if err != nil {
+		t.Skipf("inotify is not available: %v", err)
+	}
+	defer n.close()
+
+	events := make(chan WatchEvent, 10)
+	w := newWatcher(Template{Name: "git", Folder: gitTemplate}, root, Options{}, n, func(ev WatchEvent) {
+		events <- ev
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.scan(ctx, []string{w.root})
+	go w.run(ctx)
+
+	next := func() WatchEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event within 5 seconds")
+		}
+		return WatchEvent{}
+	}
+
+	// Created like git clone does: the folder first, then its contents
+	repo := filepath.Join(root, "dev", "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	makeGitRepos(t, root, "dev/repo")
+
+	if ev := next(); ev.Event != "added" || ev.Path != repo {
+		t.Errorf("expected repo to be added, got %+v", ev)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "dev")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if ev := next(); ev.Event != "removed" || ev.Path != repo {
+		t.Errorf("expected repo to be removed, got %+v", ev)
+	}
+}
+
+func TestWatcher_InotifyWrittenFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "Dockerfile", "FROM node\n")
+
+	n, err := newNotifier(true)
+	if err != nil {
+		t.Skipf("inotify is not available: %v", err)
+	}
+	defer n.close()
+
+	tpl := structure.Folder{Files: structure.Files{{Name: "Dockerfile", Contains: "FROM golang"}}}
+	events := make(chan WatchEvent, 10)
+	w := newWatcher(Template{Name: "go-docker", Folder: tpl}, root, Options{}, n, func(ev WatchEvent) {
+		events <- ev
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.scan(ctx, []string{w.root})
+	go w.run(ctx)
+
+	// Written in place, so no entry is created or removed
+	f, err := os.OpenFile(filepath.Join(root, "Dockerfile"), os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString("FROM golang\n")
+	f.Close()
+
+	select {
+	case ev := <-events:
+		if ev.Event != "added" || ev.Path != w.root {
+			t.Errorf("expected the root to be added, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event within 5 seconds")
+	}
+}
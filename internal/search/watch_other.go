@@ -0,0 +1,10 @@
+//go:build !linux
+
+package search
+
+import "errors"
+
+// newNotifier is only implemented with inotify on Linux.
+func newNotifier(contents bool) (notifier, error) {
+	return nil, errors.New("finder watch is only supported on Linux")
+}
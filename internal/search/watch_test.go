@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shadowdara/finder/internal/structure"
+)
+
+// fakeNotifier records the watched directories, the events are passed
+// to watcher.handle directly.
+type fakeNotifier struct {
+	mu   sync.Mutex
+	dirs []string
+}
+
+func (n *fakeNotifier) add(dir string) error {
+	n.mu.Lock()
+	n.dirs = append(n.dirs, dir)
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *fakeNotifier) events() <-chan []fsEvent { return nil }
+func (n *fakeNotifier) close() error             { return nil }
+
+func TestWatcher_Handle(t *testing.T) {
+	root := t.TempDir()
+	makeGitRepos(t, root, "a")
+
+	var events []string
+	n := &fakeNotifier{}
+	w := newWatcher(Template{Name: "git", Folder: gitTemplate}, root, Options{}, n, func(ev WatchEvent) {
+		events = append(events, ev.Event+" "+filepath.Base(ev.Path))
+	})
+	ctx := context.Background()
+
+	expect := func(want ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(events, want) {
+			t.Errorf("expected the events %q, got %q", want, events)
+		}
+		events = nil
+	}
+
+	w.scan(ctx, []string{w.root})
+	expect("added a")
+	if len(n.dirs) != 3 {
+		t.Errorf("expected root, a and a/.git to be watched, got %v", n.dirs)
+	}
+
+	// A cloned repository appears with its .git folder
+	makeGitRepos(t, root, "b")
+	w.handle(ctx, []fsEvent{{Dir: root, Name: "b", IsDir: true, Created: true}})
+	expect("added b")
+
+	// A folder which becomes a repository later
+	if err := os.Mkdir(filepath.Join(root, "c"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	w.handle(ctx, []fsEvent{{Dir: root, Name: "c", IsDir: true, Created: true}})
+	expect()
+	makeGitRepos(t, root, "c")
+	w.handle(ctx, []fsEvent{{Dir: filepath.Join(root, "c"), Name: ".git", IsDir: true, Created: true}})
+	expect("added c")
+
+	if err := os.RemoveAll(filepath.Join(root, "a")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	w.handle(ctx, []fsEvent{{Dir: root, Name: "a", IsDir: true, Removed: true}})
+	expect("removed a")
+
+	if err := os.Remove(filepath.Join(root, "b", ".git")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	w.handle(ctx, []fsEvent{{Dir: filepath.Join(root, "b"), Name: ".git", IsDir: true, Removed: true}})
+	expect("removed b")
+
+	// Lost events check everything again
+	makeGitRepos(t, root, "d")
+	if err := os.RemoveAll(filepath.Join(root, "c")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	w.handle(ctx, []fsEvent{{Overflow: true}})
+	expect("removed c", "added d")
+}
+
+func TestWatcher_IgnoresExcludedDirectories(t *testing.T) {
+	root := t.TempDir()
+
+	var events []string
+	w := newWatcher(Template{Name: "git", Folder: gitTemplate}, root, Options{MaxDepth: 1}, &fakeNotifier{}, func(ev WatchEvent) {
+		events = append(events, ev.Event+" "+filepath.Base(ev.Path))
+	})
+	ctx := context.Background()
+	w.scan(ctx, []string{w.root})
+
+	makeGitRepos(t, root, "node_modules/x", "a/deep")
+	w.handle(ctx, []fsEvent{
+		{Dir: root, Name: "node_modules", IsDir: true, Created: true},
+		{Dir: filepath.Join(root, "a"), Name: "deep", IsDir: true, Created: true},
+	})
+	if len(events) != 0 {
+		t.Errorf("expected no events for excluded and too deep directories, got %q", events)
+	}
+}
+
+func TestNestingDepth(t *testing.T) {
+	if d := nestingDepth(gitTemplate); d != 1 {
+		t.Errorf("expected depth 1, got %d", d)
+	}
+}
+
+func TestWatcher_HandleWrittenFiles(t *testing.T) {
+	root := t.TempDir()
+	proj := filepath.Join(root, "a", "proj")
+	if err := os.MkdirAll(proj, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeFile(t, proj, "package.json", `{"name": "x"}`)
+
+	tpl := structure.Folder{Name: "*", Files: structure.Files{{Name: "package.json", Keys: []structure.Key{{Path: "dependencies.react"}}}}}
+	parent := structure.Folder{Name: "*", Folders: []structure.Folder{{Name: "*", DataSize: structure.Size{Min: 1, Min_size_type: "KB"}}}}
+	if !readsFiles(tpl) || checksTree(tpl) || !checksTree(parent) || readsFiles(gitTemplate) {
+		t.Fatalf("unexpected readsFiles or checksTree")
+	}
+
+	var events []string
+	w := newWatcher(Template{Name: "react", Folder: tpl}, root, Options{}, &fakeNotifier{}, func(ev WatchEvent) {
+		events = append(events, ev.Event+" "+filepath.Base(ev.Path))
+	})
+	ctx := context.Background()
+	w.scan(ctx, []string{w.root})
+
+	writeFile(t, proj, "package.json", `{"dependencies": {"react": "18"}}`)
+	w.handle(ctx, []fsEvent{{Dir: proj, Name: "package.json"}})
+	if !reflect.DeepEqual(events, []string{"added proj"}) {
+		t.Errorf("expected proj to be added, got %q", events)
+	}
+
+	// A folder size rule checks all parents, not only the nesting depth
+	events = nil
+	w = newWatcher(Template{Name: "big", Folder: parent}, root, Options{}, &fakeNotifier{}, func(ev WatchEvent) {
+		events = append(events, ev.Event+" "+filepath.Base(ev.Path))
+	})
+	w.scan(ctx, []string{w.root})
+	events = nil
+	writeFile(t, proj, "big.bin", strings.Repeat("x", 2048))
+	w.handle(ctx, []fsEvent{{Dir: proj, Name: "big.bin"}})
+	if !reflect.DeepEqual(events, []string{"added " + filepath.Base(root), "added a"}) {
+		t.Errorf("expected root and a to be added, got %q", events)
+	}
+}
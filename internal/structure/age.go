@@ -0,0 +1,70 @@
+package structure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ageUnits are the units of an age besides the ones of time.ParseDuration.
+var ageUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// ParseAge parses an age like 30d, 2w, 1y or any duration of
+// time.ParseDuration like 12h or 90m.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s != "" {
+		if unit, ok := ageUnits[s[len(s)-1:]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s', use e.g. 12h, 30d, 2w or 1y", s)
+	}
+	return d, nil
+}
+
+// ParseTime returns the point in time of a modified_within or
+// modified_before value: an age before now like 30d, a date like
+// 2025-01-01 in local time or a time in RFC 3339.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	age, err := ParseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s', use an age like 30d or a date like 2025-01-01", s)
+	}
+	return now.Add(-age), nil
+}
+
+// validateAge checks the modified_within and modified_before values of a
+// file or folder.
+func validateAge(within, before string) error {
+	if within != "" {
+		if _, err := ParseTime(within, time.Now()); err != nil {
+			return fmt.Errorf("modified_within: %v", err)
+		}
+	}
+	if before != "" {
+		if _, err := ParseTime(before, time.Now()); err != nil {
+			return fmt.Errorf("modified_before: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package structure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"30d":                  now.Add(-30 * 24 * time.Hour),
+		"2w":                   now.Add(-14 * 24 * time.Hour),
+		"1y":                   now.Add(-365 * 24 * time.Hour),
+		"12h":                  now.Add(-12 * time.Hour),
+		"1h30m":                now.Add(-90 * time.Minute),
+		"2025-01-01":           time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local),
+		"2025-01-01T10:00:00Z": time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+	for value, want := range cases {
+		got, err := ParseTime(value, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) returned error: %v", value, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"", "30", "d", "-3d", "1.5d", "2025-13-01", "yesterday"} {
+		if _, err := ParseTime(value, now); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestValidate_Ages(t *testing.T) {
+	valid := Folder{
+		ModifiedWithin: "30d",
+		Files:          Files{{Name: "a", ModifiedBefore: "2025-01-01"}},
+		Folders:        []Folder{{Name: "b", ModifiedBefore: "1y"}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected valid ages, got %v", err)
+	}
+
+	invalid := []Folder{
+		{ModifiedWithin: "soon"},
+		{Files: Files{{Name: "a", ModifiedBefore: "30"}}},
+		{Folders: []Folder{{Name: "b", ModifiedWithin: "x"}}},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", f)
+		}
+	}
+}
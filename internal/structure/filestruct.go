@@ -2,19 +2,57 @@ package structure
 
 import (
 	"encoding/json"
+	"regexp"
 
 	"fmt"
+
+	"github.com/shadowdara/finder/pub/manifest"
 )
 
-// For Existance Keyword
-// required		muss existieren
-// forbidden 	darf nicht existieren
-// optional		wird ignoriert -> but that would be pretty useless ngl
+// Values of the existence keyword
+// required		the file has to exist (default)
+// forbidden 	the file must not exist
+// optional		the file does not have to exist, when it does its weight is
+// 				added to the match score
 
 type File struct {
-	Name      string `json:"name"`
-	Existence string `json:"existence,omitempty"`
-	DataSize  Size   `json:"size,omitempty"`
+	Name           string `json:"name"`
+	Existence      string `json:"existence,omitempty"`
+	DataSize       Size   `json:"size,omitempty"`
+	ModifiedWithin string `json:"modified_within,omitempty"` // Age like 30d or date like 2025-01-01, the file was modified after it
+	ModifiedBefore string `json:"modified_before,omitempty"` // Age or date, the file was last modified before it
+	Weight         int    `json:"weight,omitempty"`          // Added to the score when an optional file exists, default 1
+	Contains       string `json:"contains,omitempty"`        // Text the start of the file has to contain
+	Matches        string `json:"matches,omitempty"`         // Regular expression the start of the file has to match, ^ and $ match at every line
+	Keys           []Key  `json:"keys,omitempty"`            // Keys the file has to contain, parsed as Format
+	Format         string `json:"format,omitempty"`          // json, toml or yaml, default by the file extension
+}
+
+// Key checks a dotted key path like dependencies.react in a JSON, TOML
+// or YAML file. Without Equals and Matches the key only has to exist.
+type Key struct {
+	Path    string `json:"path"`
+	Equals  string `json:"equals,omitempty"`  // The value as text has to be equal
+	Matches string `json:"matches,omitempty"` // The value as text has to match this regular expression
+}
+
+// UnmarshalJSON also accepts a plain path as the short form of a key
+// which has to exist.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*k = Key{Path: path}
+		return nil
+	}
+
+	// Without the methods of Key to not call this function again
+	type key Key
+	var full key
+	if err := json.Unmarshal(data, &full); err != nil {
+		return fmt.Errorf("invalid key format")
+	}
+	*k = Key(full)
+	return nil
 }
 
 type Files []File
@@ -50,7 +88,52 @@ func (f *Files) Validate() error {
 			return fmt.Errorf("duplicate file entry: %s", file.Name)
 		}
 		seen[file.Name] = true
+
+		if file.Matches != "" {
+			if _, err := regexp.Compile("(?m)" + file.Matches); err != nil {
+				return fmt.Errorf("invalid matches pattern of %s: %v", file.Name, err)
+			}
+		}
+
+		if err := file.validateKeys(); err != nil {
+			return fmt.Errorf("invalid keys of %s: %v", file.Name, err)
+		}
 	}
 
 	return nil
 }
+
+// validateKeys checks the key rules and that the format of the file is
+// known.
+func (file File) validateKeys() error {
+	if file.Format != "" && !contains(manifest.Formats, file.Format) {
+		return fmt.Errorf("unknown format: %s", file.Format)
+	}
+	if len(file.Keys) == 0 {
+		return nil
+	}
+	if file.Format == "" && manifest.FormatOf(file.Name) == "" {
+		return fmt.Errorf("the format can not be found from the name, set format to json, toml or yaml")
+	}
+
+	for _, k := range file.Keys {
+		if k.Path == "" {
+			return fmt.Errorf("a key without a path")
+		}
+		if k.Matches != "" {
+			if _, err := regexp.Compile(k.Matches); err != nil {
+				return fmt.Errorf("invalid matches pattern of %s: %v", k.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
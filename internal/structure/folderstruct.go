@@ -5,7 +5,9 @@ package structure
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"regexp"
 
 	"github.com/shadowdara/finder/pub/json5"
 )
@@ -15,15 +17,26 @@ import (
 // decode them after the lightweight JSON5 preprocessing step.
 type Folder struct {
 	// To check that to old templates are not used an the user will be informed!
-	MinVersion    string   `json:"min_version,omitempty`
-	Description   string   `json:"description"`
-	Name          string   `json:"name"`
-	Folders       []Folder `json:"folders"`
-	Files         Files    `json:"files"`        // Only the filename for now
-	Command       string   `json:"command"`      // Optional command to execute after finding directory
-	InvertCommand bool     `json:invert_command` // To change if return code 0 or 1 is required. False is equal to 0
-	Tags          []string `json:tags`           // tags to sort the Templates
-	DataSize      Size     `json:"size,omitempty"`
+	MinVersion     string   `json:"min_version,omitempty"`
+	Description    string   `json:"description"`
+	Name           string   `json:"name"`
+	Existence      string   `json:"existence,omitempty"` // Only used for nested folders, same values as for File
+	Folders        []Folder `json:"folders"`
+	Files          Files    `json:"files"`                        // Only the filename for now
+	Command        string   `json:"command"`                      // Optional command to execute after finding directory
+	InvertCommand  bool     `json:"invert_command"`               // To change if return code 0 or 1 is required. False is equal to 0
+	CommandMode    string   `json:"command_mode,omitempty"`       // exit_code, stdout_nonempty or stdout_matches, empty keeps the old output check
+	ExitCode       *int     `json:"expected_exit_code,omitempty"` // Exit code the command must return, default 0 for exit_code
+	CommandMatch   string   `json:"command_pattern,omitempty"`    // Regular expression the output must match for stdout_matches
+	Tags           []string `json:"tags"`                         // tags to sort the Templates
+	DataSize       Size     `json:"size,omitempty"`
+	ModifiedWithin string   `json:"modified_within,omitempty"` // Age like 30d or date like 2025-01-01, the folder was modified after it
+	ModifiedBefore string   `json:"modified_before,omitempty"` // Age or date, the folder was last modified before it
+	MaxDepth       int      `json:"max_depth,omitempty"`       // Max depth below the search root, 0 is unlimited
+	Skip           []string `json:"skip,omitempty"`            // Gitignore style patterns for directories to skip while searching
+	PruneMatches   bool     `json:"prune_matches,omitempty"`   // Do not search inside a found directory
+	Weight         int      `json:"weight,omitempty"`          // Added to the score of the parent when an optional folder exists, default 1
+	MinScore       int      `json:"min_score,omitempty"`       // Score the optional files and folders must reach for a match
 }
 
 // NewFolder constructs a minimal Folder instance with reasonable defaults.
@@ -60,5 +73,88 @@ func LoadJSON5(data string /*, filename string */) Folder {
 		log.Fatalf("Invalid template: %v", err)
 	}
 
+	if err := f.Validate(); err != nil {
+		log.Fatalf("Invalid template: %v", err)
+	}
+
 	return f
 }
+
+// CommandModes are the values for command_mode. The empty mode keeps the
+// old behaviour: the command has to print more than 0 bytes, or more
+// than 1 byte with invert_command.
+var CommandModes = []string{"", "exit_code", "stdout_nonempty", "stdout_matches"}
+
+// Validate checks the command settings of the folder and the files and
+// command settings of its nested folders.
+func (f Folder) Validate() error {
+	if err := f.validateCommand(); err != nil {
+		return err
+	}
+	for _, sub := range f.Folders {
+		if err := sub.validateNested(); err != nil {
+			return err
+		}
+	}
+
+	return f.validateAges()
+}
+
+// validateNested checks a nested folder and the folders inside it. The
+// ages are checked once for the whole tree by validateAges.
+func (f Folder) validateNested() error {
+	if err := f.Files.Validate(); err != nil {
+		return fmt.Errorf("folder %s: %v", f.Name, err)
+	}
+	if err := f.validateCommand(); err != nil {
+		return fmt.Errorf("folder %s: %v", f.Name, err)
+	}
+	for _, sub := range f.Folders {
+		if err := sub.validateNested(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCommand checks command_mode and command_pattern of the folder.
+func (f Folder) validateCommand() error {
+	valid := false
+	for _, m := range CommandModes {
+		if f.CommandMode == m {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("unknown command_mode: %s", f.CommandMode)
+	}
+
+	if f.CommandMode == "stdout_matches" {
+		if f.CommandMatch == "" {
+			return fmt.Errorf("command_mode stdout_matches needs a command_pattern")
+		}
+		if _, err := regexp.Compile(f.CommandMatch); err != nil {
+			return fmt.Errorf("invalid command_pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateAges checks the modified_within and modified_before values of
+// the folder, its files and its nested folders.
+func (f Folder) validateAges() error {
+	if err := validateAge(f.ModifiedWithin, f.ModifiedBefore); err != nil {
+		return fmt.Errorf("invalid age of folder %s: %v", f.Name, err)
+	}
+	for _, file := range f.Files {
+		if err := validateAge(file.ModifiedWithin, file.ModifiedBefore); err != nil {
+			return fmt.Errorf("invalid age of file %s: %v", file.Name, err)
+		}
+	}
+	for _, sub := range f.Folders {
+		if err := sub.validateAges(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package structure
 
 import (
+    "strings"
     "testing"
 )
 
@@ -28,3 +29,97 @@ func TestLoadJSON5_Simple(t *testing.T) {
         t.Fatalf("unexpected subfolder: %#v", f.Folders)
     }
 }
+
+func TestFolderValidate_CommandMode(t *testing.T) {
+    valid := []Folder{
+        {},
+        {CommandMode: "exit_code"},
+        {CommandMode: "stdout_nonempty"},
+        {CommandMode: "stdout_matches", CommandMatch: `^ok$`},
+    }
+    for _, f := range valid {
+        if err := f.Validate(); err != nil {
+            t.Errorf("expected %+v to be valid, got %v", f, err)
+        }
+    }
+
+    invalid := []Folder{
+        {CommandMode: "exitcode"},
+        {CommandMode: "stdout_matches"},
+        {CommandMode: "stdout_matches", CommandMatch: `(`},
+    }
+    for _, f := range invalid {
+        if err := f.Validate(); err == nil {
+            t.Errorf("expected %+v to be invalid", f)
+        }
+    }
+}
+
+func TestLoadJSON5_ExpectedExitCode(t *testing.T) {
+    f := LoadJSON5(`{ name: "*", command: "exit 2", command_mode: "exit_code", expected_exit_code: 2 }`)
+
+    if f.CommandMode != "exit_code" || f.ExitCode == nil || *f.ExitCode != 2 {
+        t.Fatalf("unexpected command settings: %q %v", f.CommandMode, f.ExitCode)
+    }
+}
+
+func TestLoadJSON5_FileContent(t *testing.T) {
+    f := LoadJSON5(`{ name: "*", files: [{ name: "Dockerfile", contains: "golang", matches: "^FROM " }] }`)
+
+    if len(f.Files) != 1 || f.Files[0].Contains != "golang" || f.Files[0].Matches != "^FROM " {
+        t.Errorf("expected the content rules of the file, got %+v", f.Files)
+    }
+
+    invalid := Files{{Name: "Dockerfile", Matches: `(`}}
+    if err := invalid.Validate(); err == nil {
+        t.Errorf("expected an invalid matches pattern to be rejected")
+    }
+}
+
+func TestLoadJSON5_FileKeys(t *testing.T) {
+    f := LoadJSON5(`{ name: "*", files: [{ name: "package.json", keys: ["dependencies.react", { path: "name", equals: "web" }] }] }`)
+
+    want := []Key{{Path: "dependencies.react"}, {Path: "name", Equals: "web"}}
+    if len(f.Files) != 1 || len(f.Files[0].Keys) != 2 || f.Files[0].Keys[0] != want[0] || f.Files[0].Keys[1] != want[1] {
+        t.Errorf("expected the keys %+v, got %+v", want, f.Files)
+    }
+
+    invalid := []Files{
+        {{Name: "Makefile", Keys: []Key{{Path: "all"}}}},
+        {{Name: "a.json", Format: "xml", Keys: []Key{{Path: "a"}}}},
+        {{Name: "a.json", Keys: []Key{{Path: ""}}}},
+        {{Name: "a.json", Keys: []Key{{Path: "a", Matches: "("}}}},
+    }
+    for _, files := range invalid {
+        if err := files.Validate(); err == nil {
+            t.Errorf("expected %+v to be invalid", files)
+        }
+    }
+}
+
+func TestFolderValidate_NestedFolders(t *testing.T) {
+    nested := func(sub Folder) Folder {
+        return Folder{Folders: []Folder{{Name: "a", Folders: []Folder{sub}}}}
+    }
+
+    valid := nested(Folder{Name: "b", CommandMode: "exit_code", Files: Files{{Name: "go.mod", Keys: []Key{{Path: "module"}}, Format: "toml"}}})
+    if err := valid.Validate(); err != nil {
+        t.Errorf("expected nested folders to be valid, got %v", err)
+    }
+
+    invalid := []Folder{
+        nested(Folder{Name: "b", CommandMode: "exitcode"}),
+        nested(Folder{Name: "b", CommandMode: "stdout_matches", CommandMatch: `(`}),
+        nested(Folder{Name: "b", Files: Files{{Name: "Dockerfile", Matches: `(`}}}),
+        nested(Folder{Name: "b", Files: Files{{Name: "Makefile", Keys: []Key{{Path: "all"}}}}}),
+        nested(Folder{Name: "b", Files: Files{{Name: "a"}, {Name: "a"}}}),
+    }
+    for _, f := range invalid {
+        err := f.Validate()
+        if err == nil {
+            t.Errorf("expected %+v to be invalid", f.Folders[0].Folders[0])
+        } else if !strings.Contains(err.Error(), "folder b") {
+            t.Errorf("expected the error to name the nested folder, got %v", err)
+        }
+    }
+}
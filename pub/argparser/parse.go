@@ -10,12 +10,13 @@ import (
 
 // Flag represents a single CLI option.
 //
-// A flag can either be a string or a boolean value.
+// A flag can either be a string, a list of strings or a boolean value.
 //
 // Examples:
 //
 //	--name=John
 //	--verbose
+//	--root a --root b
 //
 // Supported features:
 //   - Long flags: --name
@@ -27,10 +28,12 @@ type Flag struct {
 	Usage    string   // Description shown in help output
 	Required bool     // Whether the flag must be provided
 
-	StringValue string // Value for string flags
-	BoolValue   bool   // Value for boolean flags
-	IsBool      bool   // Flag type (true = bool, false = string)
-	Set         bool   // Indicates whether the flag was explicitly set
+	StringValue  string   // Value for string flags
+	StringValues []string // Values for repeatable string flags
+	BoolValue    bool     // Value for boolean flags
+	IsBool       bool     // Flag type (true = bool, false = string)
+	IsList       bool     // Flag can be given multiple times
+	Set          bool     // Indicates whether the flag was explicitly set
 }
 
 // Command represents a CLI command.
@@ -49,6 +52,7 @@ type Command struct {
 	Subcommands map[string]*Command // Registered subcommands
 	Parent      *Command            // Parent command (used to build full path)
 	Args        []string            // Positional arguments
+	Rest        []string            // Arguments after "--", not parsed as flags
 }
 
 // NewCommand creates a new Command.
@@ -97,6 +101,27 @@ func (c *Command) String(name, def, usage string, required bool, aliases ...stri
 	}
 }
 
+// Strings registers a repeatable string flag. Every occurrence of the
+// flag appends its value.
+//
+// Example:
+//
+//	cmd.Strings("root", "Search root", false, "C")
+//
+// CLI usage:
+//
+//	--root /home --root=/mnt -C /srv
+func (c *Command) Strings(name, usage string, required bool, aliases ...string) {
+	c.Flags[name] = &Flag{
+		Name:     name,
+		Aliases:  aliases,
+		Usage:    usage,
+		Required: required,
+		IsBool:   false,
+		IsList:   true,
+	}
+}
+
 // Bool registers a boolean flag.
 //
 // Example:
@@ -181,6 +206,12 @@ func (c *Command) Parse(args []string) *Command {
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
+		// Everything after "--" is passed on unparsed
+		if arg == "--" {
+			c.Rest = append(c.Rest, args[i+1:]...)
+			break
+		}
+
 		// Long flags (--flag or --flag=value)
 		if strings.HasPrefix(arg, "--") {
 			key := strings.TrimPrefix(arg, "--")
@@ -192,8 +223,7 @@ func (c *Command) Parse(args []string) *Command {
 				value := parts[1]
 
 				if f := c.findFlag(key); f != nil && !f.IsBool {
-					f.StringValue = value
-					f.Set = true
+					f.setString(value)
 				}
 				continue
 			}
@@ -204,8 +234,7 @@ func (c *Command) Parse(args []string) *Command {
 					f.BoolValue = true
 					f.Set = true
 				} else if i+1 < len(args) {
-					f.StringValue = args[i+1]
-					f.Set = true
+					f.setString(args[i+1])
 					i++
 				}
 				continue
@@ -221,8 +250,7 @@ func (c *Command) Parse(args []string) *Command {
 					f.BoolValue = true
 					f.Set = true
 				} else if i+1 < len(args) {
-					f.StringValue = args[i+1]
-					f.Set = true
+					f.setString(args[i+1])
 					i++
 				}
 				continue
@@ -253,6 +281,24 @@ func (c *Command) GetString(name string) string {
 	return ""
 }
 
+// GetStrings returns all values of a repeatable string flag.
+func (c *Command) GetStrings(name string) []string {
+	if f := c.findFlag(name); f != nil {
+		return f.StringValues
+	}
+	return nil
+}
+
+// setString stores a value for a string flag. Repeatable flags collect
+// every value, normal string flags keep the last one.
+func (f *Flag) setString(value string) {
+	if f.IsList {
+		f.StringValues = append(f.StringValues, value)
+	}
+	f.StringValue = value
+	f.Set = true
+}
+
 // GetBool returns the value of a boolean flag.
 func (c *Command) GetBool(name string) bool {
 	if f := c.findFlag(name); f != nil {
@@ -0,0 +1,138 @@
+// Package manifest reads the keys of small configuration files like
+// package.json, Cargo.toml or pubspec.yaml. JSON and JSON5 are parsed
+// completely, for TOML and YAML only the common subset used by project
+// manifests is supported: tables, key/value pairs, arrays and inline
+// values for TOML, block mappings, block sequences and scalars for YAML.
+//
+// Parsed documents are made of map[string]interface{}, []interface{},
+// string, float64, bool and nil like encoding/json produces them.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shadowdara/finder/pub/json5"
+)
+
+// Formats are the supported formats of Parse.
+var Formats = []string{"json", "toml", "yaml"}
+
+// FormatOf returns the format of a file by its name, "" when it is not
+// known.
+func FormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".json5", ".jsonc":
+		return "json"
+	case ".toml":
+		return "toml"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+
+	switch name {
+	case "Pipfile", "Cargo.lock", "poetry.lock":
+		return "toml"
+	case ".babelrc", ".eslintrc", ".prettierrc":
+		return "json"
+	}
+	return ""
+}
+
+// Parse parses data in format, see Formats.
+func Parse(format string, data []byte) (interface{}, error) {
+	switch format {
+	case "json":
+		return parseJSON(data)
+	case "toml":
+		return parseTOML(string(data))
+	case "yaml":
+		return parseYAML(string(data))
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// parseJSON parses plain JSON and falls back to the JSON5 preprocessing
+// for comments and unquoted keys.
+func parseJSON(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err == nil {
+		return doc, nil
+	}
+
+	if err := json.Unmarshal([]byte(json5.PreprocessJSON5(string(data))), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Lookup returns the values at a dotted key path like
+// "dependencies.react". A number selects an element of an array, any
+// other key is looked up in every element of an array, so "bin.name"
+// finds the names of all [[bin]] tables. No values means the key does
+// not exist.
+func Lookup(doc interface{}, path string) []interface{} {
+	values := []interface{}{doc}
+	for _, key := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, lookupKey(v, key)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		values = next
+	}
+	return values
+}
+
+// lookupKey returns the values of key in a single value.
+func lookupKey(v interface{}, key string) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if child, ok := v[key]; ok {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if i, err := strconv.Atoi(key); err == nil {
+			if i >= 0 && i < len(v) {
+				return []interface{}{v[i]}
+			}
+			return nil
+		}
+
+		var found []interface{}
+		for _, element := range v {
+			found = append(found, lookupKey(element, key)...)
+		}
+		return found
+	}
+	return nil
+}
+
+// String formats a value for comparisons: strings as they are, numbers
+// without trailing zeros, null as "null" and maps and arrays as JSON.
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,241 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const cargoTOML = `
+# Cargo.toml
+[package]
+name = "finder-rs"   # the name
+version = "0.1.0"
+edition = '2021'
+authors = [
+    "a <a@example.com>", # first
+    "b",
+]
+
+[package.metadata]
+notes = """
+first # no comment
+]"""
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+tokio.version = "1"
+"quoted.key" = 3
+
+[tool.poetry]
+name = "py"
+
+[[bin]]
+name = "one"
+
+[[bin]]
+name = "two"
+path = "src/two.rs"
+`
+
+const pubspecYAML = `---
+# pubspec.yaml
+name: app
+description: "An app: with a colon"
+version: 1.0.0 # comment
+environment:
+  sdk: '>=3.0.0 <4.0.0'
+dependencies:
+  flutter:
+    sdk: flutter
+  http: ^1.1.0
+tags: [mobile, "web"]
+services:
+- name: db
+  image: postgres
+-   name: web
+    ports:
+      - "80:80"
+script: |
+  line one
+  line two
+empty:
+...
+ignored: true
+`
+
+// values parses data and returns the values at path as strings.
+func values(t *testing.T, format, data, path string) []string {
+	t.Helper()
+	doc, err := Parse(format, []byte(data))
+	if err != nil {
+		t.Fatalf("parse %s: %v", format, err)
+	}
+
+	var found []string
+	for _, v := range Lookup(doc, path) {
+		found = append(found, String(v))
+	}
+	return found
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{
+		"name": "app",
+		"version": 1.5,
+		"private": true,
+		"homepage": "https://example.com",
+		"dependencies": { "react": "^18.2.0", "@types/node": "20" },
+		"workspaces": ["a", "b"]
+	}`
+
+	cases := map[string][]string{
+		"name":               {"app"},
+		"version":            {"1.5"},
+		"private":            {"true"},
+		"homepage":           {"https://example.com"},
+		"dependencies.react": {"^18.2.0"},
+		"workspaces.1":       {"b"},
+		"workspaces.2":       nil,
+		"dependencies.vue":   nil,
+		"name.first":         nil,
+	}
+	for path, want := range cases {
+		if got := values(t, "json", data, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestParseJSON5(t *testing.T) {
+	data := `{
+		// comment
+		compilerOptions: { strict: true }
+	}`
+	if got := values(t, "json", data, "compilerOptions.strict"); !reflect.DeepEqual(got, []string{"true"}) {
+		t.Errorf("expected true, got %v", got)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	data := cargoTOML
+
+	cases := map[string][]string{
+		"package.name":                {"finder-rs"},
+		"package.edition":             {"2021"},
+		"package.authors.0":           {"a <a@example.com>"},
+		"package.authors":             {`["a <a@example.com>","b"]`},
+		"package.metadata.notes":      {"first # no comment\n]"},
+		"dependencies.serde.version":  {"1.0"},
+		"dependencies.serde.features": {`["derive"]`},
+		"dependencies.tokio.version":  {"1"},
+		"dependencies.quoted.key":     nil,
+		"tool.poetry":                 {`{"name":"py"}`},
+		"bin.name":                    {"one", "two"},
+		"bin.1.path":                  {"src/two.rs"},
+	}
+	for path, want := range cases {
+		if got := values(t, "toml", data, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+
+	doc, _ := Parse("toml", []byte(data))
+	deps := doc.(map[string]interface{})["dependencies"].(map[string]interface{})
+	if deps["quoted.key"] != 3.0 {
+		t.Errorf("expected the quoted key, got %v", deps)
+	}
+}
+
+func TestParseTOML_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"key", `key = "open`, "a = 1\na.b = 2",
+		"a = [}", `deps = ["x", }]`, "a = [1 2 }", "a = { b = [}] }",
+		"a = []\na.b = 1", "a = []\n[a.b]", "[[]]", "[a..b]",
+		// Cut off in a long array, every line must only be read once
+		"a = [\n" + strings.Repeat("\"x\",\n", 50000),
+	} {
+		if _, err := Parse("toml", []byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	data := pubspecYAML
+
+	cases := map[string][]string{
+		"name":                     {"app"},
+		"description":              {"An app: with a colon"},
+		"version":                  {"1.0.0"},
+		"environment.sdk":          {">=3.0.0 <4.0.0"},
+		"dependencies.flutter.sdk": {"flutter"},
+		"dependencies.http":        {"^1.1.0"},
+		"tags.1":                   {"web"},
+		"services.name":            {"db", "web"},
+		"services.1.ports.0":       {"80:80"},
+		"script":                   {"line one\nline two"},
+		"empty":                    {"null"},
+		"ignored":                  nil,
+	}
+	for path, want := range cases {
+		if got := values(t, "yaml", data, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	cases := map[string]string{
+		"package.json":   "json",
+		"tsconfig.json5": "json",
+		"Cargo.toml":     "toml",
+		"Pipfile":        "toml",
+		"pubspec.yaml":   "yaml",
+		"compose.yml":    "yaml",
+		"Makefile":       "",
+	}
+	for name, want := range cases {
+		if got := FormatOf(name); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+// TestParse_Truncated parses every prefix of the example documents, like
+// a file cut off at the content limit. Parsing must neither panic nor
+// hang.
+func TestParse_Truncated(t *testing.T) {
+	docs := map[string]string{
+		"toml": cargoTOML,
+		"yaml": pubspecYAML,
+		"json": `{"a": [1, {"b": "c"}], "d": {"e": null}}`,
+	}
+	for format, data := range docs {
+		for i := range data {
+			Parse(format, []byte(data[:i]))
+		}
+	}
+}
+
+func TestParseYAML_Malformed(t *testing.T) {
+	for _, data := range []string{
+		"-", "- -", "a:\n-\n  - b:", ":", "a: [b, {c", "a: |\n", "\"a: b", "'': x", "a:\n  b\n c: d\n- e",
+	} {
+		Parse("yaml", []byte(data))
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, data := range []string{cargoTOML, pubspecYAML, "a = [}", "a = []\na.b = 1", `{"a": 1}`} {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		for _, format := range Formats {
+			doc, err := Parse(format, []byte(data))
+			if err == nil {
+				Lookup(doc, "a.0.b")
+			}
+		}
+	})
+}
@@ -0,0 +1,362 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the TOML subset of manifests like Cargo.toml and
+// pyproject.toml: [tables], [[arrays of tables]], dotted and quoted
+// keys, strings, numbers, booleans, arrays and inline tables. Dates
+// and other values are kept as strings.
+func parseTOML(text string) (interface{}, error) {
+	root := map[string]interface{}{}
+	current := root
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "[["):
+			keys, err := splitTOMLKey(strings.TrimSuffix(strings.TrimPrefix(line, "[["), "]]"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			parent, err := tomlTable(root, keys[:len(keys)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+
+			table := map[string]interface{}{}
+			last := keys[len(keys)-1]
+			list, _ := parent[last].([]interface{})
+			parent[last] = append(list, table)
+			current = table
+
+		case strings.HasPrefix(line, "["):
+			keys, err := splitTOMLKey(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if current, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+
+		default:
+			eq := indexOutsideQuotes(line, '=')
+			if eq < 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", i+1)
+			}
+			keys, err := splitTOMLKey(line[:eq])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+
+			// Arrays and strings can span several lines
+			start := i
+			var value strings.Builder
+			var open tomlOpen
+			value.WriteString(strings.TrimSpace(line[eq+1:]))
+			open.scan(value.String())
+			for !open.complete() && i+1 < len(lines) {
+				i++
+				next := lines[i]
+				if open.quote == "" {
+					next = stripTOMLComment(next)
+				}
+				value.WriteString("\n" + next)
+				open.scan(next)
+			}
+
+			v, _, err := parseTOMLValue(value.String())
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", start+1, err)
+			}
+			table, err := tomlTable(current, keys[:len(keys)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", start+1, err)
+			}
+			table[keys[len(keys)-1]] = v
+		}
+	}
+
+	return root, nil
+}
+
+// tomlTable returns the table at keys below m and creates the missing
+// ones. For an array of tables the last table is used.
+func tomlTable(m map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch child := m[key].(type) {
+		case nil:
+			table := map[string]interface{}{}
+			m[key] = table
+			m = table
+		case map[string]interface{}:
+			m = child
+		case []interface{}:
+			if len(child) == 0 {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			table, ok := child[len(child)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			m = table
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return m, nil
+}
+
+// splitTOMLKey splits a dotted key like a."b.c".d into its parts.
+func splitTOMLKey(s string) ([]string, error) {
+	var keys []string
+	for _, part := range splitOutsideQuotes(s, '.') {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') && part[len(part)-1] == part[0] {
+			part = part[1 : len(part)-1]
+		} else if part == "" {
+			return nil, fmt.Errorf("invalid key %q", strings.TrimSpace(s))
+		}
+		keys = append(keys, part)
+	}
+	return keys, nil
+}
+
+// parseTOMLValue parses the value at the start of s and returns the
+// text after it.
+func parseTOMLValue(s string) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s == "" {
+		return nil, "", fmt.Errorf("missing value")
+	}
+
+	switch {
+	case strings.HasPrefix(s, `"""`), strings.HasPrefix(s, "'''"):
+		quote := s[:3]
+		end := strings.Index(s[3:], quote)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		value := strings.TrimPrefix(s[3:3+end], "\n")
+		if quote == `"""` {
+			value = unescape(value)
+		}
+		return value, s[3+end+3:], nil
+
+	case s[0] == '"':
+		end := closingQuote(s)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return unescape(s[1:end]), s[end+1:], nil
+
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : 1+end], s[end+2:], nil
+
+	case s[0] == '[':
+		list := []interface{}{}
+		rest := s[1:]
+		for {
+			rest = strings.TrimLeft(rest, " \t\r\n,")
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+			if rest[0] == ']' {
+				return list, rest[1:], nil
+			}
+
+			v, after, err := parseTOMLValue(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, v)
+			rest = after
+		}
+
+	case s[0] == '{':
+		table := map[string]interface{}{}
+		rest := s[1:]
+		for {
+			rest = strings.TrimLeft(rest, " \t,")
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated inline table")
+			}
+			if rest[0] == '}' {
+				return table, rest[1:], nil
+			}
+
+			eq := indexOutsideQuotes(rest, '=')
+			if eq < 0 {
+				return nil, "", fmt.Errorf("expected key = value in inline table")
+			}
+			keys, err := splitTOMLKey(rest[:eq])
+			if err != nil {
+				return nil, "", err
+			}
+			v, after, err := parseTOMLValue(rest[eq+1:])
+			if err != nil {
+				return nil, "", err
+			}
+			parent, err := tomlTable(table, keys[:len(keys)-1])
+			if err != nil {
+				return nil, "", err
+			}
+			parent[keys[len(keys)-1]] = v
+			rest = after
+		}
+	}
+
+	// Bare values end at the next separator
+	end := strings.IndexAny(s, ",]}\n")
+	if end < 0 {
+		end = len(s)
+	}
+	word := strings.TrimSpace(s[:end])
+	if word == "" {
+		// Nothing was read, like the } in [}
+		return nil, "", fmt.Errorf("unexpected %q", s[0])
+	}
+
+	switch word {
+	case "true":
+		return true, s[end:], nil
+	case "false":
+		return false, s[end:], nil
+	}
+	if n, err := strconv.ParseFloat(strings.ReplaceAll(word, "_", ""), 64); err == nil {
+		return n, s[end:], nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 0, 64); err == nil {
+		return float64(n), s[end:], nil
+	}
+	return word, s[end:], nil
+}
+
+// tomlOpen tracks the open arrays, inline tables and multi-line strings
+// of a value while it is read line by line, so every line is only
+// scanned once.
+type tomlOpen struct {
+	depth int
+	quote string // delimiter of the open string
+}
+
+// scan reads the next line of a value.
+func (o *tomlOpen) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		if o.quote != "" {
+			switch {
+			case line[i] == '\\' && o.quote[0] == '"':
+				i++
+			case strings.HasPrefix(line[i:], o.quote):
+				i += len(o.quote) - 1
+				o.quote = ""
+			}
+			continue
+		}
+
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], `"""`), strings.HasPrefix(line[i:], "'''"):
+			o.quote = line[i : i+3]
+			i += 2
+		case c == '"' || c == '\'':
+			o.quote = line[i : i+1]
+		case c == '[' || c == '{':
+			o.depth++
+		case c == ']' || c == '}':
+			o.depth--
+		}
+	}
+
+	// Only multi-line strings continue on the next line, a broken string
+	// is reported by parseTOMLValue
+	if o.quote == `"` || o.quote == "'" {
+		o.quote = ""
+	}
+}
+
+// complete reports whether no arrays, inline tables or strings are left
+// open.
+func (o *tomlOpen) complete() bool {
+	return o.quote == "" && o.depth <= 0
+}
+
+// stripTOMLComment removes a # comment which is not inside a string.
+func stripTOMLComment(line string) string {
+	if i := indexOutsideQuotes(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// indexOutsideQuotes returns the index of the first c in s which is not
+// inside a quoted string, -1 when there is none.
+func indexOutsideQuotes(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitOutsideQuotes splits s at every sep which is not inside a quoted
+// string.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexOutsideQuotes(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// closingQuote returns the index of the quote which ends the double
+// quoted string at the start of s, -1 when it is not terminated.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape resolves the backslash escapes of a double quoted string.
+// Unknown escapes are kept as they are.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	if u, err := strconv.Unquote(`"` + strings.ReplaceAll(s, "\n", `\n`) + `"`); err == nil {
+		return u
+	}
+	return s
+}
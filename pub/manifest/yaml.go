@@ -0,0 +1,222 @@
+package manifest
+
+import (
+	"strings"
+)
+
+// yamlLine is a line of a YAML document without its indentation.
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// yamlParser parses the YAML subset of manifests like pubspec.yaml or
+// docker-compose.yml: block mappings, block sequences, block scalars
+// (| and >), quoted and plain scalars and simple flow sequences and
+// mappings. Only the first document is read, anchors and tags are not
+// resolved. All scalars are strings, ~ and null are nil.
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func parseYAML(text string) (interface{}, error) {
+	p := &yamlParser{}
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "---" || trimmed == "..." {
+			if len(p.lines) > 0 {
+				break
+			}
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "%") {
+			continue
+		}
+
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		p.lines = append(p.lines, yamlLine{indent: indent, text: strings.TrimRight(raw[indent:], " \t")})
+	}
+
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	return p.block(p.lines[0].indent), nil
+}
+
+// block parses the mapping or sequence starting at the current line.
+func (p *yamlParser) block(indent int) interface{} {
+	if isYAMLItem(p.lines[p.i].text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(p.lines[p.i].text); ok {
+		return p.mapping(indent)
+	}
+
+	// A plain scalar, possibly on several lines
+	var parts []string
+	for p.i < len(p.lines) && p.lines[p.i].indent >= indent {
+		parts = append(parts, p.lines[p.i].text)
+		p.i++
+	}
+	return yamlScalar(strings.Join(parts, " "))
+}
+
+// sequence parses the "- item" lines with the given indentation.
+func (p *yamlParser) sequence(indent int) []interface{} {
+	list := []interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent != indent || !isYAMLItem(l.text) {
+			break
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				list = append(list, p.block(p.lines[p.i].indent))
+			} else {
+				list = append(list, nil)
+			}
+			continue
+		}
+
+		// "- key: value" starts a mapping and "- - x" a sequence, both
+		// continue at the column of the item
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLItem(rest) {
+			column := indent + len(l.text) - len(rest)
+			p.lines[p.i] = yamlLine{indent: column, text: rest}
+			list = append(list, p.block(column))
+			continue
+		}
+
+		p.i++
+		list = append(list, yamlScalar(rest))
+	}
+	return list
+}
+
+// mapping parses the "key: value" lines with the given indentation.
+func (p *yamlParser) mapping(indent int) map[string]interface{} {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+
+		key, rest, ok := splitYAMLKey(l.text)
+		if l.indent > indent || !ok {
+			// Not part of this mapping, like a broken line
+			p.i++
+			continue
+		}
+		p.i++
+
+		switch {
+		case rest == "":
+			if p.i < len(p.lines) && (p.lines[p.i].indent > indent ||
+				p.lines[p.i].indent == indent && isYAMLItem(p.lines[p.i].text)) {
+				m[key] = p.block(p.lines[p.i].indent)
+			} else {
+				m[key] = nil
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			m[key] = p.blockScalar(indent, rest[0] == '|')
+		default:
+			m[key] = yamlScalar(rest)
+		}
+	}
+	return m
+}
+
+// blockScalar joins the lines indented deeper than indent, with line
+// breaks for | and spaces for >.
+func (p *yamlParser) blockScalar(indent int, literal bool) string {
+	var parts []string
+	for p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		parts = append(parts, p.lines[p.i].text)
+		p.i++
+	}
+
+	if literal {
+		return strings.Join(parts, "\n")
+	}
+	return strings.Join(parts, " ")
+}
+
+// isYAMLItem reports whether text is an item of a block sequence.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" into the key and the value without a
+// comment. ok is false when text is no mapping entry.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || isYAMLItem(text) || strings.ContainsRune("[{#&*!|>", rune(text[0])) {
+		return "", "", false
+	}
+
+	end := -1
+	if text[0] == '"' || text[0] == '\'' {
+		if close := strings.IndexByte(text[1:], text[0]); close >= 0 {
+			key = text[1 : close+1]
+			if strings.HasPrefix(text[close+2:], ":") {
+				end = close + 2
+			}
+		}
+	} else {
+		for i := 0; i < len(text); i++ {
+			if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+				end = i
+				key = strings.TrimSpace(text[:i])
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return "", "", false
+	}
+
+	rest = strings.TrimSpace(text[end+1:])
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return key, rest, true
+}
+
+// yamlScalar converts an inline value: quoted and plain strings and
+// simple flow sequences and mappings.
+func yamlScalar(s string) interface{} {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, " #"); i >= 0 && s[0] != '"' && s[0] != '\'' {
+		s = strings.TrimSpace(s[:i])
+	}
+
+	switch {
+	case s == "" || s == "~" || s == "null" || s == "Null" || s == "NULL":
+		return nil
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return unescape(s[1 : len(s)-1])
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	case len(s) >= 2 && s[0] == '[' && s[len(s)-1] == ']':
+		list := []interface{}{}
+		if inner := strings.TrimSpace(s[1 : len(s)-1]); inner != "" {
+			for _, item := range splitOutsideQuotes(inner, ',') {
+				list = append(list, yamlScalar(item))
+			}
+		}
+		return list
+	case len(s) >= 2 && s[0] == '{' && s[len(s)-1] == '}':
+		m := map[string]interface{}{}
+		for _, item := range splitOutsideQuotes(s[1:len(s)-1], ',') {
+			if key, rest, ok := splitYAMLKey(strings.TrimSpace(item)); ok {
+				m[key] = yamlScalar(rest)
+			}
+		}
+		return m
+	}
+	return s
+}